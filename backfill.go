@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// backfill re-parses the raw listing text of order files whose normalized column is still empty.
+// query reads (Filename, raw text) pairs; parse turns a raw text into the arguments of update, which takes the
+// filename as its last argument. Raw texts which can't be parsed are printed for review.
+// Returns the numbers of updated and unparseable rows.
+func backfill(db *sql.DB, query, update string, parse func(raw string) ([]any, error)) (int, int, error) {
+	type rawValue struct {
+		filename string
+		raw      string
+	}
+	values := make([]rawValue, 0)
+
+	// Read from DB rows without the normalized value
+	rows, err := db.Query(query)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error reading raw values: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var el rawValue
+		err = rows.Scan(&el.filename, &el.raw)
+		if err != nil {
+			slog.Error("Error during scanning raw value row from db", "error", err)
+			continue
+		}
+		values = append(values, el)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error reading raw values: %w", err)
+	}
+	rows.Close()
+
+	statement, err := db.Prepare(update)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error preparing update: %w", err)
+	}
+	defer statement.Close()
+
+	// Update parseable values, print the rest for review
+	updated, unparsed := 0, 0
+	for _, el := range values {
+		args, err := parse(el.raw)
+		if err != nil {
+			unparsed++
+			fmt.Printf("%s\t%q\t%v\n", el.filename, el.raw, err)
+			continue
+		}
+		_, err = statement.Exec(append(args, el.filename)...)
+		if err != nil {
+			slog.Error("Error during update in db", "file", el.filename, "error", err)
+			continue
+		}
+		updated++
+	}
+	return updated, unparsed, nil
+}
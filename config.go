@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Config prints the effective configuration and its validation result, and returns the exit code
+// Usage: config check
+func Config(args []string, loadErr error) int {
+	if len(args) != 1 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: romaniabot [-config file] config check")
+		return exitUsage
+	}
+
+	fmt.Print(cfg)
+
+	if loadErr != nil {
+		fmt.Fprintf(os.Stderr, "\nconfiguration is invalid:\n%v\n", loadErr)
+		return exitFailed
+	}
+	fmt.Fprintln(os.Stderr, "\nconfiguration is valid")
+	return exitOK
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/api"
+	"romaniabot/pkg/metrics"
+	"romaniabot/pkg/pipeline"
+	"romaniabot/pkg/report"
+)
+
+var (
+	lastRun = metrics.NewGauge("romaniabot_last_successful_run_timestamp_seconds",
+		"Unix time of the last completed pipeline run.")
+	pendingFiles = metrics.NewGauge("romaniabot_pending_files",
+		"Order files waiting for a pipeline stage (download, parse), stuck on a broken URL (broken) or needing OCR (needs_ocr).", "stage")
+	pipelineRuns = metrics.NewCounter("romaniabot_pipeline_runs_total",
+		"Daemon pipeline runs by result (ok, partial: some files or URLs failed, failed: a stage failed).", "result")
+)
+
+// retryDelay is the longest wait before re-running a pipeline run in which a stage failed
+const retryDelay = 15 * time.Minute
+
+// updatePendingMetrics refreshes the pending files gauges from DB
+func updatePendingMetrics(db *sql.DB) {
+	var download, parse, broken, needsOCR int
+	err := db.QueryRow(model.Get_Pending_per_Stage).Scan(&download, &parse, &broken, &needsOCR)
+	if err != nil {
+		slog.Error("Pending files reading error", "error", err)
+		return
+	}
+	pendingFiles.Set(float64(download), "download")
+	pendingFiles.Set(float64(parse), "parse")
+	pendingFiles.Set(float64(broken), "broken")
+	pendingFiles.Set(float64(needsOCR), "needs_ocr")
+}
+
+// Daemon runs the pipeline on a schedule and serves the API, /metrics and the report until interrupted
+// Usage: daemon [-addr addr] [-interval duration], server.addr and scheduler.interval from the config by default
+// A run in which a stage failed is retried after retryDelay instead of the interval.
+// Returns an error if the HTTP server fails.
+func Daemon(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	addr := flags.String("addr", cfg.Server.Addr, "address to listen on")
+	interval := flags.Duration("interval", cfg.Scheduler.Interval, "time between pipeline runs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := createBlobFolders(); err != nil {
+		return err
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	handler := api.NewServer(db, cfg.Storage.OrdersPath, cfg.Storage.SnapshotsPath)
+	handler.Handle("/metrics", metrics.Handler())
+	handler.Handle("/report/", http.StripPrefix("/report/", report.Handler(cfg.Storage.ReportsPath)))
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Serving API and metrics", "addr", *addr)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("HTTP server error: %w", err)
+			stop()
+		}
+	}()
+
+	updatePendingMetrics(db)
+
+	for {
+		runID = newRunID()
+		slog.Info("Pipeline run started", "run", runID)
+		err := runPipeline(ctx, db)
+
+		next := *interval
+		switch {
+		case err == nil:
+			pipelineRuns.Inc("ok")
+		case pipeline.Partial(err):
+			pipelineRuns.Inc("partial")
+		default:
+			pipelineRuns.Inc("failed")
+			next = min(next, retryDelay)
+		}
+		slog.Info("Pipeline run finished", "run", runID, "ok", err == nil, "next", time.Now().Add(next).Format(time.RFC3339))
+
+		timer := time.NewTimer(next)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Shutting down")
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+			select {
+			case err := <-serverErr:
+				return err
+			default:
+				return nil
+			}
+		case <-timer.C:
+		}
+	}
+}
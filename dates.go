@@ -0,0 +1,33 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/extractors"
+)
+
+// nullDate converts an order date to its database form, NULL for the zero date
+func nullDate(t time.Time) sql.NullString {
+	if t.IsZero() {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Format(extractors.DateLayout), Valid: true}
+}
+
+// Dates re-parses raw listing dates which have no normalized date yet and lists those which still can't be parsed
+func Dates(db *sql.DB) error {
+	updated, unparsed, err := backfill(db, model.Get_Raw_Dates_not_parsed, model.Set_Order_Date,
+		func(raw string) ([]any, error) {
+			orderDate, err := extractors.ParseDate(raw)
+			return []any{nullDate(orderDate)}, err
+		})
+	if err != nil {
+		return fmt.Errorf("error normalizing dates: %w", err)
+	}
+	slog.Info("Dates normalized", "count", updated, "to_review", unparsed)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"romaniabot/model"
+	"romaniabot/pkg/dossier"
+)
+
+// errDossierNotFound fails the dossier command when the dossier isn't in any parsed order; it is reported by the
+// command's output, not logged, and the process exits with exitNotFound
+var errDossierNotFound = errors.New("dossier not found")
+
+// Dossier prints the orders which resolved a dossier number typed the way users do, e.g. "12345 RD 19" or
+// "dosar nr. 12345/rd/2019": dossier, order file, order name, order date and URL. Without category letters every
+// category with that number and year is printed, one per line.
+// A dossier which isn't found is reported with the dossier numbers one typo away and a rough estimate of when its
+// order may come.
+// Usage: dossier <number>
+func Dossier(ctx context.Context, db *sql.DB, args []string) error {
+	text := strings.Join(args, " ")
+	if text == "" {
+		return usageError("usage: dossier <number>, e.g. dossier 12345/RD/2019")
+	}
+
+	match, err := dossier.Lookup(ctx, db, text)
+	if err != nil {
+		return err
+	}
+
+	if len(match.Orders) > 0 {
+		for _, order := range match.Orders {
+			printDossier(db, order)
+		}
+		return nil
+	}
+	fmt.Printf("Dossier %s not found\n", match.Query)
+	if len(match.Candidates) > 0 {
+		fmt.Println("Did you mean:")
+		for _, candidate := range match.Candidates {
+			printDossier(db, candidate)
+		}
+	}
+	fmt.Println(match.Estimate.Summary())
+	return errDossierNotFound
+}
+
+// printDossier prints a dossier with its order file; the order file columns are "-" if its row is missing
+func printDossier(db *sql.DB, order model.Order) {
+	name, orderDate, url := "-", "-", "-"
+	file, err := model.ScanOrderFile(db.QueryRow(model.Get_Order_File, order.Filename))
+	if err == nil {
+		name, url = file.Name, file.URL
+		if !file.OrderDate.IsZero() {
+			orderDate = file.OrderDate.Format("2006-01-02")
+		}
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\t%s\n", order.FullNameFormatted, order.Filename, name, orderDate, url)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"romaniabot/pkg/export"
+)
+
+// Export writes a dataset for analysis tools: order-files, orders (dossiers) or occurrences (dossiers with their
+// order file), as CSV, JSON Lines or Parquet, to a file or stdout. Rows can be filtered by source, order date range
+// and dossier year. With -since only rows changed at or after the watermark are written; -watermark keeps the
+// watermark in a file, reading it before the export and saving the new one after it succeeded.
+// Usage: export [-format csv|jsonl|parquet] [-o file] [-source url] [-from date] [-to date] [-year y]
+// [-since watermark | -watermark file] <order-files|orders|occurrences>
+func Export(ctx context.Context, db *sql.DB, args []string) error {
+	names := make([]string, len(export.Datasets))
+	for i, d := range export.Datasets {
+		names[i] = d.Name
+	}
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "csv", "output format: "+strings.Join(export.Formats, ", "))
+	out := flags.String("o", "-", "output file, - for stdout")
+	source := flags.String("source", "", "only order files found on this listing page")
+	from := flags.String("from", "", "first order date, YYYY-MM-DD")
+	to := flags.String("to", "", "last order date, YYYY-MM-DD")
+	year := flags.Uint("year", 0, "only dossiers of this year, or order files containing them")
+	since := flags.String("since", "", "only rows changed at or after this watermark")
+	watermarkFile := flags.String("watermark", "", "file holding the watermark between incremental exports")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("export needs one dataset: %s", strings.Join(names, ", "))
+	}
+	dataset, ok := export.DatasetByName(flags.Arg(0))
+	if !ok {
+		return fmt.Errorf("unknown dataset %q, expected one of %s", flags.Arg(0), strings.Join(names, ", "))
+	}
+	if *since != "" && *watermarkFile != "" {
+		return errors.New("-since and -watermark can't be used together")
+	}
+	for _, date := range []string{*from, *to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return fmt.Errorf("invalid order date %q, expected YYYY-MM-DD", date)
+		}
+	}
+
+	filter := export.Filter{Source: *source, From: *from, To: *to, Year: *year}
+	raw := *since
+	if *watermarkFile != "" {
+		data, err := os.ReadFile(*watermarkFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error reading watermark file: %w", err)
+		}
+		// A missing or empty watermark file starts with a full export
+		raw = strings.TrimSpace(string(data))
+	}
+	if raw != "" {
+		watermark, err := export.ParseWatermark(raw)
+		if err != nil {
+			return err
+		}
+		filter.Since = watermark
+	}
+
+	result, err := exportTo(ctx, db, *out, dataset, *format, filter)
+	if err != nil {
+		return err
+	}
+	if *watermarkFile != "" {
+		if err := os.WriteFile(*watermarkFile, []byte(result.Watermark+"\n"), 0640); err != nil {
+			return fmt.Errorf("error saving watermark: %w", err)
+		}
+	}
+	slog.Info("Export finished", "dataset", dataset.Name, "format", *format, "rows", result.Rows,
+		"watermark", result.Watermark)
+	return nil
+}
+
+// exportTo writes the export to stdout, or to a temporary file renamed to path once complete,
+// so a failed export doesn't leave a truncated file behind
+func exportTo(ctx context.Context, db *sql.DB, path string, dataset export.Dataset, format string,
+	filter export.Filter) (export.Result, error) {
+	if path == "-" {
+		return export.Write(ctx, db, os.Stdout, dataset, format, filter)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return export.Result{}, fmt.Errorf("error creating export file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	result, err := export.Write(ctx, db, tmp, dataset, format, filter)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	// Temporary files are private, exports are for other tools
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return result, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return result, fmt.Errorf("error writing export file %s: %w", path, err)
+	}
+	return result, nil
+}
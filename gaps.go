@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"romaniabot/pkg/dossier"
+)
+
+// Gaps reports unresolved dossier numbers inside otherwise resolved ranges, one per line: year, category, number,
+// the resolved neighbours, coverage around the gap, verdict and evidence. The verdict tells parser misses, found
+// in the indexed page text, from dossiers which may be in order files that aren't parsed and from stuck dossiers.
+// Usage: gaps [-year y] [-max-gap n] [-window n] [-min-coverage share]
+func Gaps(ctx context.Context, db *sql.DB, args []string) error {
+	defaults := dossier.DefaultGapOptions
+	flags := flag.NewFlagSet("gaps", flag.ContinueOnError)
+	year := flags.Uint("year", 0, "only this dossier year")
+	maxGap := flags.Int("max-gap", defaults.MaxGap, "longest run of missing numbers reported")
+	window := flags.Int("window", defaults.Window, "numbers on each side of a gap the coverage is measured on")
+	minCoverage := flags.Float64("min-coverage", defaults.MinCoverage, "share of resolved numbers around a gap, 0..1")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *maxGap < 1 || *window < 1 || *minCoverage < 0 || *minCoverage > 1 {
+		return fmt.Errorf("invalid gaps options: -max-gap and -window must be positive, -min-coverage within 0..1")
+	}
+
+	// Parser misses are only found in indexed page text
+	unindexed, err := dossier.Unindexed(ctx, db)
+	if err != nil {
+		return err
+	}
+	if unindexed > 0 {
+		slog.Warn("Order files without indexed page text, parser misses in them are reported as stuck; run search -reindex",
+			"count", unindexed)
+	}
+
+	opts := dossier.GapOptions{Year: *year, MaxGap: *maxGap, Window: *window, MinCoverage: *minCoverage}
+	gaps, err := dossier.Gaps(ctx, db, opts)
+	if err != nil {
+		return err
+	}
+
+	verdicts := make(map[string]int)
+	fmt.Println("year\tcategory\tnumber\tbetween\tcoverage\tverdict\tevidence")
+	for _, gap := range gaps {
+		category := gap.Category
+		if category == "" {
+			category = "-"
+		}
+		for _, m := range gap.Missing {
+			verdicts[m.Verdict]++
+			fmt.Printf("%d\t%s\t%d\t%d..%d\t%.0f%%\t%s\t%s\n", gap.Year, category, m.Number, gap.Left.Number,
+				gap.Right.Number, gap.Coverage*100, m.Verdict, m.Evidence)
+		}
+	}
+	slog.Info("Gap detection finished", "gaps", len(gaps), dossier.VerdictParserMiss, verdicts[dossier.VerdictParserMiss],
+		dossier.VerdictUnparsed, verdicts[dossier.VerdictUnparsed], dossier.VerdictStuck, verdicts[dossier.VerdictStuck])
+	return nil
+}
@@ -6,6 +6,8 @@ require golang.org/x/net v0.19.0
 
 require modernc.org/sqlite v1.28.0
 
+require gopkg.in/yaml.v3 v3.0.1
+
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.3.0 // indirect
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"romaniabot/pkg/jobs"
+	"romaniabot/pkg/pipeline"
+)
+
+// Jobs inspects the download and parse job queue
+// Usage:
+//
+//	jobs list [status] [limit]
+//	jobs retry <job id>
+func Jobs(ctx context.Context, db *sql.DB, args []string) error {
+	usage := usageError("usage: jobs list [pending|leased|done|dead] [limit] | retry <job id>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "list":
+		status, limit := "", 50
+		for _, arg := range args[1:] {
+			if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+				limit = n
+				continue
+			}
+			if arg != jobs.StatusPending && arg != jobs.StatusLeased && arg != jobs.StatusDone && arg != jobs.StatusDead {
+				return usage
+			}
+			status = arg
+		}
+		list, err := jobs.List(ctx, db, status, limit)
+		if err != nil {
+			return err
+		}
+		for _, j := range list {
+			leasedUntil := "-"
+			if j.LeasedUntil != nil && j.Status == jobs.StatusLeased {
+				leasedUntil = j.LeasedUntil.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\tattempts=%d\towner=%s\tleased_until=%s\trun_after=%s\t%s\n", j.ID, j.Kind, j.Filename,
+				j.Status, j.Attempts, j.LeaseOwner, leasedUntil, j.RunAfter.Format(time.RFC3339), j.LastError)
+		}
+
+	case "retry":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid job ID %q", args[1]))
+		}
+		if err := jobs.Retry(ctx, db, id); err != nil {
+			return err
+		}
+		fmt.Println("Job queued again:", id)
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// Worker works the download and parse jobs until interrupted; several workers can run at once on one database.
+// Before every poll, jobs are queued for the order files waiting for them.
+// Usage: worker [-kind download|parse] [-poll duration] [-once], both kinds and queue.pollInterval by default
+// With -once the worker exits when no job is due, returning the failed attempts.
+func Worker(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("worker", flag.ContinueOnError)
+	kind := flags.String("kind", "", "work only jobs of this kind (download or parse)")
+	poll := flags.Duration("poll", cfg.Queue.PollInterval, "time between looks for new jobs")
+	once := flags.Bool("once", false, "exit when no job is due")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	handlers := map[string]jobs.Handler{
+		jobs.KindDownload: downloadHandler(db),
+		jobs.KindParse:    parseHandler(db),
+	}
+	kinds := jobs.Kinds
+	if *kind != "" {
+		if _, ok := handlers[*kind]; !ok {
+			return fmt.Errorf("unknown job kind %q", *kind)
+		}
+		kinds = []string{*kind}
+	}
+
+	slog.Info("Worker started", "owner", jobs.Owner(), "kinds", kinds, "poll", poll.String())
+	for {
+		var errs []error
+		for _, k := range kinds {
+			err := workQueue(ctx, db, k, handlers[k])
+			var items *pipeline.Errors
+			switch {
+			case err == nil:
+			case errors.As(err, &items):
+				for _, item := range items.Items {
+					slog.Warn("Job attempt failed", "kind", k, item.Kind, item.Item, "error", item.Err)
+				}
+			default:
+				slog.Error("Job queue error", "kind", k, "error", err)
+			}
+			errs = append(errs, err)
+		}
+		if err := flushWebhooks(ctx, db); err != nil {
+			slog.Error("Webhook delivery error", "error", err)
+			errs = append(errs, err)
+		}
+
+		if *once {
+			return errors.Join(errs...)
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("Worker stopped")
+			return nil
+		case <-time.After(*poll):
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"romaniabot/pkg/config"
+)
+
+// newLogger returns a logger writing to stderr in the configured format and level.
+// Records logged with a context carry the attributes added to it by withLogAttrs.
+func newLogger(c config.Log) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Level)) // validated by config.Load, info if empty
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if c.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// logAttrsKey is the context key of the attributes added by withLogAttrs
+type logAttrsKey struct{}
+
+// withLogAttrs returns a copy of ctx whose log records carry attrs, e.g. the run ID and stage name of a stage
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	parent, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(parent[:len(parent):len(parent)], attrs...))
+}
+
+// contextHandler adds the attributes of the record's context to the record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(logAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
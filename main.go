@@ -3,385 +3,627 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 
 	"log/slog"
 
 	"romaniabot/model"
+	"romaniabot/pkg/config"
 	"romaniabot/pkg/downloaders"
 	"romaniabot/pkg/extractors"
 	"romaniabot/pkg/fileutil"
+	"romaniabot/pkg/jobs"
+	"romaniabot/pkg/pipeline"
 	"romaniabot/pkg/web"
+	"romaniabot/pkg/webhooks"
 
 	"database/sql"
 
 	_ "modernc.org/sqlite"
-
-	"golang.org/x/net/html"
-	"golang.org/x/net/html/atom"
 )
 
-var (
-	liTags     []string
-	OrderFiles []model.OrderFile
-)
-
-const (
-	url = "https://cetatenie.just.ro/ordine-articolul-1-1/" // TODO: slice of links
-	//	outputFile = "output.txt"
-	ordersPath = "orders/"
-	allowedApp = "application/pdf"
-)
+// cfg is the effective configuration, loaded from the -config file and ROMANIABOT_* environment variables
+var cfg = config.Default()
 
 func main() {
-	// Initialize logger
-	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
-	slog.SetDefault(logger)
+	os.Exit(run())
+}
+
+// run runs the command given on the command line and returns the process exit code
+func run() int {
+	// Initialize logger, replaced by the configured one once the config is loaded
+	slog.SetDefault(newLogger(cfg.Log))
+
+	// Global flags go before the command: romaniabot [-config file] [-record dir | -replay dir] <command>
+	configPath := flag.String("config", os.Getenv("ROMANIABOT_CONFIG"), "YAML config file, overridden by ROMANIABOT_* environment variables")
+	recordDir := flag.String("record", "", "save every HTTP response to this fixture folder")
+	replayDir := flag.String("replay", "", "serve HTTP responses from this fixture folder instead of the network")
+	flag.Parse()
+
+	// Load configuration
+	var err error
+	cfg, err = config.Load(*configPath)
+	if flag.Arg(0) == "config" {
+		return Config(flag.Args()[1:], err)
+	}
+	if err != nil {
+		slog.Error("Configuration error", "error", err)
+		return exitFailed
+	}
+	slog.SetDefault(newLogger(cfg.Log))
+	web.UserAgent = cfg.HTTP.UserAgent
+	web.Timeout = cfg.HTTP.Timeout
+	err = web.Configure(web.Options{
+		Proxy:           cfg.HTTP.Proxy,
+		CABundle:        cfg.HTTP.CABundle,
+		MaxConnsPerHost: cfg.HTTP.MaxConnsPerHost,
+		Gzip:            cfg.HTTP.Gzip,
+	})
+	if err != nil {
+		slog.Error("HTTP client initializing error", "error", err)
+		return exitFailed
+	}
+	loc, _ := cfg.Politeness.Location()
+	quietHours, _ := web.ParseQuietHours(cfg.Politeness.QuietHours, loc) // validated by config.Load
+	web.SetPoliteness(web.Politeness{
+		RespectRobots: cfg.Politeness.RespectRobots,
+		MinDelay:      cfg.Politeness.MinDelay,
+		QuietHours:    quietHours,
+	})
+
+	// Interrupting the process cancels outbound requests of the running command
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	downloaders.AllowedContentType = cfg.HTTP.AllowedContentType
+	jobs.VisibilityTimeout = cfg.Queue.VisibilityTimeout
+	jobs.MaxAttempts = cfg.Queue.MaxAttempts
+	jobs.Backoff = cfg.Queue.Backoff
+
+	switch {
+	case *recordDir != "" && *replayDir != "":
+		slog.Error("-record and -replay can't be used together")
+		return exitFailed
+	case *recordDir != "":
+		transport, err := web.NewRecorder(*recordDir, web.Transport)
+		if err != nil {
+			slog.Error("Recorder initializing error", "error", err)
+			return exitFailed
+		}
+		web.Transport = transport
+	case *replayDir != "":
+		server, err := web.NewReplayServer(*replayDir)
+		if err != nil {
+			slog.Error("Replay server initializing error", "error", err)
+			return exitFailed
+		}
+		defer server.Close()
+		web.Transport = web.NewReplayTransport(server)
+		slog.Info("Replaying recorded responses", "dir", *replayDir, "server", server.URL)
+	}
 
 	// Initialize database
-	db, err := sql.Open("sqlite", "./orders.db")
+	db, err := sql.Open("sqlite", dataSource(cfg.Storage.DBPath))
 	if err != nil {
-		slog.Error("Database initializing error: %e", err)
-		return
+		slog.Error("Database initializing error", "error", err)
+		return exitFailed
 	}
 	defer db.Close()
 
-	// Create OrderFiles table in the database
-	_, err = db.Exec(model.CreateOrderFilesDB)
+	// Create or upgrade tables in the database
+	err = model.Migrate(db)
 	if err != nil {
-		slog.Error("Database table for OrderFiles creating error: %e", err)
-		return
+		slog.Error("Database migration error", "error", err)
+		return exitFailed
 	}
 
-	// Create Orders table in the database
-	_, err = db.Exec(model.CreateOrdersDB)
-	if err != nil {
-		slog.Error("Database table for Orders creating error: %e", err)
-		return
+	// Run the requested command, the whole pipeline by default
+	command := "run"
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	args := flag.Args()
+	if len(args) > 0 {
+		args = args[1:]
+	}
+
+	switch command {
+	case "run":
+		err = runPipeline(ctx, db)
+	case "scrape":
+		err = errors.Join(
+			stage(ctx, db, stageScrape, func(ctx context.Context) error { return Scrape(ctx, db, args) }),
+			stage(ctx, db, stageWebhooks, func(ctx context.Context) error { return flushWebhooks(ctx, db) }),
+		)
+	case "snapshots":
+		err = Snapshots(ctx, db)
+	case "snapshot-diff":
+		err = SnapshotDiff(ctx, db, args)
+	case "check":
+		err = stage(ctx, db, stageCheck, func(ctx context.Context) error {
+			return errors.Join(FilesToDownloadCheck(ctx, db), URLsToCheck(ctx, db))
+		})
+	case "download":
+		err = errors.Join(
+			stage(ctx, db, stageDownload, func(ctx context.Context) error { return Download(ctx, db) }),
+			stage(ctx, db, stageWebhooks, func(ctx context.Context) error { return flushWebhooks(ctx, db) }),
+		)
+	case "parse":
+		err = errors.Join(
+			stage(ctx, db, stageParse, func(ctx context.Context) error { return Parse(ctx, db, args) }),
+			stage(ctx, db, stageWebhooks, func(ctx context.Context) error { return flushWebhooks(ctx, db) }),
+		)
+	case "dates":
+		err = Dates(db)
+	case "names":
+		err = Names(db)
+	case "serve":
+		err = Serve(ctx, db, args)
+	case "daemon":
+		err = Daemon(ctx, db, args)
+	case "webhooks":
+		err = Webhooks(ctx, db, args)
+	case "jobs":
+		err = Jobs(ctx, db, args)
+	case "worker":
+		err = Worker(ctx, db, args)
+	case "reconcile":
+		err = Reconcile(ctx, db, args)
+	case "search":
+		err = Search(ctx, db, args)
+	case "dossier":
+		err = Dossier(ctx, db, args)
+	case "stats":
+		err = Stats(ctx, db, args)
+	case "gaps":
+		err = Gaps(ctx, db, args)
+	case "report":
+		err = Report(ctx, db, args)
+	case "export":
+		err = Export(ctx, db, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", command)
+		fmt.Fprintln(os.Stderr, "usage: romaniabot [-config file] [-record dir | -replay dir] [run|scrape|snapshots|snapshot-diff|check|download|parse|dates|names|serve|daemon|webhooks|jobs|worker|reconcile|search|dossier|stats|gaps|report|export|config]")
+		return exitUsage
 	}
 
-	// Get <li> tags from target URL
-	// LiTagsExtractor(db)
-	// // Check downloaded order files in folder
-	// FilesToDownloadCheck(db)
-	// // Check broken URLs
-	// URLsToCheck(db)
-	// // Download order files
-	// Download(db)
-	// // Parsing orders
-	ParsePDF(db)
+	// Stages log their own errors; item failures and dossiers not found are reported by their command, and usage
+	// errors are printed
+	var (
+		stageErr *pipeline.StageError
+		usage    usageError
+	)
+	switch {
+	case errors.As(err, &usage):
+		fmt.Fprintln(os.Stderr, usage)
+	case errors.Is(err, errDossierNotFound):
+	case err != nil && !errors.As(err, &stageErr) && !pipeline.Partial(err):
+		slog.Error("Command failed", "command", command, "error", err)
+	}
 
 	// TODO: IsExtension - remove if unnecessary
 
-	// TODO: if files not parsed, parse
-	// TODO: import result to DB
 	// TODO: handles for bot
 	// TODO: TG-bot
+
+	return exitCode(err)
 }
 
-func LiTagsExtractor(db *sql.DB) {
-	// Request URL
-	body, err := web.GetResponseBody(url)
-	if err != nil {
-		log.Printf("Error during reading body response: %e\n", err)
-		return
+// runPipeline runs all stages in order; a failing stage doesn't stop the next ones.
+// Returns the errors of all failed stages.
+func runPipeline(ctx context.Context, db *sql.DB) error {
+	err := errors.Join(
+		// Get <li> tags from target URL
+		stage(ctx, db, stageScrape, func(ctx context.Context) error { return LiTagsExtractor(ctx, db) }),
+		stage(ctx, db, stageCheck, func(ctx context.Context) error {
+			// Check downloaded order files in folder, then broken URLs
+			return errors.Join(FilesToDownloadCheck(ctx, db), URLsToCheck(ctx, db))
+		}),
+		// Download order files
+		stage(ctx, db, stageDownload, func(ctx context.Context) error { return Download(ctx, db) }),
+		// Parsing orders
+		stage(ctx, db, stageParse, func(ctx context.Context) error { return ParsePDF(ctx, db) }),
+		// Send webhook events
+		stage(ctx, db, stageWebhooks, func(ctx context.Context) error { return flushWebhooks(ctx, db) }),
+	)
+
+	// Item failures don't make the run unsuccessful, they are retried by the next run
+	if err == nil || pipeline.Partial(err) {
+		lastRun.Set(float64(time.Now().Unix()))
 	}
+	updatePendingMetrics(db)
+	return err
+}
 
-	// Extract <li> tags
-	reader := bytes.NewReader(body)
-	z := html.NewTokenizer(reader)
+// LiTagsExtractor scrapes every configured listing page.
+// Pages which can't be fetched or saved are returned as a *pipeline.Errors.
+func LiTagsExtractor(ctx context.Context, db *sql.DB) error {
+	var failed pipeline.Errors
+	for _, source := range cfg.Sources {
+		// Request URL
+		body, err := web.GetResponseBody(ctx, source)
+		if err != nil {
+			failed.Add(pipeline.URLError(source, err))
+			continue
+		}
 
-	for {
-		tt := z.Next()
-		if tt == html.ErrorToken {
-			err := z.Err()
-			slog.Error("Error in main (html.ErrorToken):", err)
-			break
+		// Keep a copy of the page if it changed since the last scrape
+		err = archiveSnapshot(ctx, db, source, body)
+		if err != nil {
+			failed.Add(pipeline.URLError(source, fmt.Errorf("error archiving listing snapshot: %w", err)))
 		}
-		if tt == html.StartTagToken && z.Token().DataAtom == atom.Li {
-			tag, err := extractors.InsideTags(z, atom.Li)
-			if err != nil {
-				log.Printf("Error during extracting <li>: %e\n", err)
-				return
-			}
-			if tag != "" {
-				liTags = append(liTags, tag)
-			}
+
+		if err := failed.Merge(saveListing(ctx, db, source, body)); err != nil {
+			failed.Add(pipeline.URLError(source, err))
 		}
 	}
+	return failed.Err()
+}
 
-	// Extract target model
-	orderFiles, err := extractors.OrderFiles(liTags)
+// saveListing extracts order files from a listing page body of source and saves new ones to DB.
+// Order files which can't be saved are returned as a *pipeline.Errors.
+func saveListing(ctx context.Context, db *sql.DB, source string, body []byte) error {
+	// Parse the listing page, links are relative to its URL
+	base, err := url.Parse(source)
 	if err != nil {
-		log.Printf("Error during extracting order files: %e\n", err)
-		return
+		return fmt.Errorf("error parsing listing URL: %w", err)
+	}
+	listing, err := extractors.ParseListing(bytes.NewReader(body), base)
+	if err != nil {
+		return fmt.Errorf("error parsing listing: %w", err)
+	}
+
+	// Report items which could not be understood
+	for _, issue := range listing.Issues {
+		slog.WarnContext(ctx, "Unparsed listing item", "url", source, "position", issue.Position, "reason", issue.Reason, "text", issue.Text)
 	}
 
+	// Extract target model
+	orderFiles := extractors.OrderFiles(listing.Entries)
+
 	// Save order files to DB
 	statement, err := db.Prepare(model.Insert_Order_File)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("error preparing statement: %w", err)
 	}
 	defer statement.Close()
 
 	// Execute query with specific parameters
+	var failed pipeline.Errors
 	for _, el := range orderFiles {
-		_, err := statement.Exec(el.Date, el.URL, el.Filename, el.Name)
+		res, err := statement.Exec(el.Date, el.URL, el.Filename, el.Name, nullDate(el.OrderDate), nullOrderNumber(el.OrderNumber), el.OrderSeries, source)
 		if err != nil {
-			log.Printf("Error during insert in db %v: %e\n", el, err)
+			failed.Add(pipeline.FileError(el.Filename, fmt.Errorf("error inserting order file: %w", err)))
+			continue
+		}
+		// Known order files are ignored
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
 		}
+		if err := model.RecordDiscovery(ctx, db, el.Filename, source); err != nil {
+			failed.Add(pipeline.FileError(el.Filename, err))
+		}
+		emit(ctx, db, webhooks.EventOrderFileDiscovered, webhooks.OrderFileData{
+			Filename: el.Filename, Date: el.Date, Name: el.Name, URL: el.URL, Source: source,
+		})
 	}
+	return failed.Err()
 }
 
-// FilesToDownloadCheck checks the downloaded files and updates the database accordingly.
-func FilesToDownloadCheck(db *sql.DB) {
-	// Create a slice to store the filenames that need to be downloaded
-	filesToDownload := make([]string, 0)
-
-	// Query the database to get the new filenames
-	rows, err := db.QueryContext(context.Background(), model.Get_new_Filenames)
+// FilesToDownloadCheck moves order files which are already in the orders folder to the downloaded state
+func FilesToDownloadCheck(ctx context.Context, db *sql.DB) error {
+	// Query the database to get the files which are not downloaded yet
+	filesToDownload, err := queryStrings(db, model.Get_Files_not_downloaded)
 	if err != nil {
-		log.Printf("Error during reading filesToDownload from db: %e\n", err)
-		return
-	}
-	defer rows.Close()
-
-	// Iterate over the rows returned by the query
-	for rows.Next() {
-		var filename string
-
-		// Scan the filename from the row
-		err = rows.Scan(&filename)
-		if err != nil {
-			log.Printf("Error during scanning filesToDownload row from db: %s\t%e\n", filename, err)
-			continue
-		}
-
-		// Append the filename to the filesToDownload slice
-		filesToDownload = append(filesToDownload, filename)
+		return fmt.Errorf("error reading files to download: %w", err)
 	}
 
 	// Print the total number of files to be downloaded
-	fmt.Println("Total files to download from DB:", len(filesToDownload))
+	slog.InfoContext(ctx, "Files to download in DB", "count", len(filesToDownload))
 
 	// Check the downloaded files in the specified folder
-	downloadedFiles := downloaders.CheckDownloadedFiles(ordersPath, filesToDownload)
+	downloadedFiles, err := downloaders.CheckDownloadedFiles(cfg.Storage.OrdersPath, filesToDownload)
+	if err != nil {
+		return fmt.Errorf("error checking orders folder: %w", err)
+	}
 	// Print the total number of downloaded files after checking the folder
-	fmt.Println("Total downloaded files after checking folder:", len(downloadedFiles))
+	slog.InfoContext(ctx, "Files already downloaded in folder", "count", len(downloadedFiles))
 
-	// If there are downloaded files, update the database
-	if len(downloadedFiles) > 0 {
-		// Prepare the update statement
-		statement, err := db.PrepareContext(context.Background(), model.Set_is_Downloaded)
-		if err != nil {
-			log.Fatal(err)
+	// Iterate over the downloaded files and update their state
+	var failed pipeline.Errors
+	for _, el := range downloadedFiles {
+		if err := recordFileHash(ctx, db, el); err != nil {
+			failed.Add(pipeline.FileError(el, err))
+			continue
 		}
-		defer statement.Close()
-
-		// Iterate over the downloaded files and execute the update statement
-		for _, el := range downloadedFiles {
-			_, err := statement.Exec(el)
-			if err != nil {
-				log.Printf("Error during update in db %v: %e\n", el, err)
-				continue
-			}
+		err := model.SetState(ctx, db, el, model.StateDownloaded, "found in orders folder")
+		if err != nil {
+			failed.Add(pipeline.FileError(el, fmt.Errorf("error marking file as downloaded: %w", err)))
 		}
 	}
+	return failed.Err()
 }
 
-func URLsToCheck(db *sql.DB) {
-	// Create an empty slice to store the URLs that need to be checked
-	urlsToCheck := make([]string, 0)
-
-	// Query the database to get the valid URLs
-	rows, err := db.Query(model.Get_Valid_URLs)
+// URLsToCheck pings the URLs of new and failed order files and moves them to the verified or broken state
+func URLsToCheck(ctx context.Context, db *sql.DB) error {
+	// Query the database to get the URLs to verify with their filenames
+	filenames, err := queryURLs(db, model.Get_URLs_to_verify)
 	if err != nil {
-		// Log an error message if there is an error querying the database
-		log.Printf("Error during reading URLs to check from db: %e\n", err)
-		return
+		return fmt.Errorf("error reading URLs to check: %w", err)
 	}
-	defer rows.Close()
-
-	// Iterate over the rows returned from the query
-	for rows.Next() {
-		var url string
-
-		// Scan the value of the URL column into the 'url' variable
-		err = rows.Scan(&url)
-		if err != nil {
-			// Log an error message if there is an error scanning the row
-			log.Printf("Error during scanning URLs row from db: %s\t%e\n", url, err)
-			continue
-		}
-		// Append the URL to the 'urlsToCheck' slice
+	urlsToCheck := make([]string, 0, len(filenames))
+	for url := range filenames {
 		urlsToCheck = append(urlsToCheck, url)
 	}
 
 	// Print the total number of URLs to check
-	fmt.Println("Total URLs to check from DB: ", len(urlsToCheck))
+	slog.InfoContext(ctx, "URLs to check in DB", "count", len(urlsToCheck))
 
 	// Call the 'CheckBrokenURLs' function to check the broken URLs
-	brokenURLs := downloaders.CheckBrokenURLs(urlsToCheck, 2, time.Second*20)
-
-	// Print the total number of broken URLs after pinging
-	fmt.Println("Total broken URLs after ping: ", len(brokenURLs))
-
-	// If there are no broken URLs, return
-	if len(brokenURLs) == 0 {
-		return
+	brokenURLs, availableURLs := downloaders.CheckBrokenURLs(ctx, urlsToCheck, cfg.HTTP.PingRetries, cfg.HTTP.PingTimeout)
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	// Prepare a statement to update the broken URLs in the database
-	statement, err := db.Prepare(model.Set_broken_URLs)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer statement.Close()
+	// Print the total number of broken URLs after pinging
+	slog.InfoContext(ctx, "Broken URLs after ping", "count", len(brokenURLs))
 
-	// Iterate over the broken URLs and execute the update statement for each URL
+	// Iterate over the checked URLs and update the state of their files
+	var failed pipeline.Errors
 	for _, el := range brokenURLs {
-		_, err := statement.Exec(el)
-		if err != nil {
-			// Log an error message if there is an error updating the database
-			log.Printf("Error during update in db %v: %e\n", el, err)
+		reason := fmt.Sprintf("no answer after %d pings", cfg.HTTP.PingRetries)
+		if err := model.SetState(ctx, db, filenames[el], model.StateBroken, reason); err != nil {
+			failed.Add(pipeline.URLError(el, fmt.Errorf("error marking URL as broken: %w", err)))
 		}
 	}
+	for _, el := range availableURLs {
+		if err := model.SetState(ctx, db, filenames[el], model.StateVerified, "URL answered"); err != nil {
+			failed.Add(pipeline.URLError(el, fmt.Errorf("error marking URL as verified: %w", err)))
+		}
+	}
+	return failed.Err()
+}
+
+// Download queues download jobs for order files which are not downloaded yet and works the due ones.
+// Failed attempts are returned as a *pipeline.Errors; the jobs are retried by later runs or workers.
+func Download(ctx context.Context, db *sql.DB) error {
+	return workQueue(ctx, db, jobs.KindDownload, downloadHandler(db))
 }
 
-// Refactored Download function
-func Download(db *sql.DB) {
-	// Storage for FileNames to download
-	filesToDownload := make(map[string]string)
+// ParsePDF queues parse jobs for downloaded order files and works the due ones.
+// Failed attempts are returned as a *pipeline.Errors; the jobs are retried by later runs or workers.
+func ParsePDF(ctx context.Context, db *sql.DB) error {
+	return workQueue(ctx, db, jobs.KindParse, parseHandler(db))
+}
 
-	// Read from DB existing orderfiles
-	rows, err := db.Query(model.Get_Files_to_download)
+// workQueue queues the jobs of kind for the order files waiting for it, then works the due jobs of kind.
+// Failed attempts are returned as a *pipeline.Errors.
+func workQueue(ctx context.Context, db *sql.DB, kind string, h jobs.Handler) error {
+	queued, err := jobs.Enqueue(ctx, db, kind)
 	if err != nil {
-		log.Printf("Error during reading FileURLs to check from db: %e\n", err)
-		return
+		return err
 	}
-	defer rows.Close()
-
-	// Iterate over the rows returned by the query
-	for rows.Next() {
-		var filename string
-		var url string
-
-		err = rows.Scan(&url, &filename)
-		if err != nil {
-			log.Printf("Error during scanning URLs row from db:%s\t%s\t%e\n", url, filename, err)
-			continue
-		}
-
-		// Add the filename and url to the filesToDownload map
-		filesToDownload[filename] = url
+	if queued > 0 {
+		slog.InfoContext(ctx, "Jobs queued", "kind", kind, "count", queued)
 	}
 
-	fmt.Println("Total Files to download from DB: ", len(filesToDownload))
-	downloaders.Downloader(ordersPath, filesToDownload)
-
-	// Update information in the database
-	statement, err := db.Prepare(model.Set_is_Downloaded)
-	if err != nil {
-		log.Fatal(err)
-		return
+	// Failed attempts are collected for the stage result
+	var failed pipeline.Errors
+	onFailure := h.Failed
+	h.Failed = func(ctx context.Context, job model.Job, err error, dead bool) {
+		onFailure(ctx, job, err, dead)
+		failed.Add(pipeline.FileError(job.Filename, err))
 	}
-	defer statement.Close()
 
-	// Execute the query with specific parameters
-	for fname := range filesToDownload {
-		_, err := statement.Exec(fname)
-		if err != nil {
-			log.Printf("Error during update in db %v: %e\n", fname, err)
-			continue
-		}
+	result, err := jobs.Work(ctx, db, kind, jobs.Owner(), h)
+	if result.Done+result.Retry+result.Dead > 0 {
+		slog.InfoContext(ctx, "Jobs finished", "kind", kind, "done", result.Done, "retry", result.Retry, "dead", result.Dead)
 	}
-}
-
-// Parse PDF
-func ParsePDF(db *sql.DB) {
-	// Storage for FileNames which are parsed by data from DB
-	parsedFiles := make([]string, 0)
-	filesToParse := make([]string, 0)
-
-	// Read from DB filenames
-	rows, err := db.Query(model.Get_Files_not_parsed)
 	if err != nil {
-		log.Printf("Error during reading FileURLs to check from db: %e\n", err)
-		return
+		return err
 	}
-	defer rows.Close()
+	return failed.Err()
+}
 
-	// Iterate over the rows returned by the query
-	for rows.Next() {
-		var filename string
+// downloadHandler downloads the order file of a job and moves it to the downloaded state,
+// or to the failed state if the attempt fails
+func downloadHandler(db *sql.DB) jobs.Handler {
+	return jobs.Handler{
+		Handle: func(ctx context.Context, job model.Job) error {
+			file, err := model.ScanOrderFile(db.QueryRowContext(ctx, model.Get_Order_File, job.Filename))
+			if err != nil {
+				return fmt.Errorf("error reading order file: %w", err)
+			}
+			reason := fmt.Sprintf("download job %d, attempt %d", job.ID, job.Attempts)
+			if err := model.SetState(ctx, db, job.Filename, model.StateDownloading, reason); err != nil {
+				return err
+			}
 
-		err = rows.Scan(&filename)
-		if err != nil {
-			log.Printf("Error during scanning URLs row from db:%s\t%e\n", filename, err)
-			continue
-		}
+			saved, err := downloaders.Downloader(ctx, cfg.Storage.OrdersPath, map[string]string{job.Filename: file.URL})
+			if len(saved) == 0 {
+				return itemErr(err)
+			}
 
-		// Add the filename to the slice
-		parsedFiles = append(parsedFiles, filename)
+			// The file is saved, so its state is updated even if the run is being interrupted
+			ctx = context.WithoutCancel(ctx)
+			if err := recordFileHash(ctx, db, job.Filename); err != nil {
+				return err
+			}
+			if err := model.SetState(ctx, db, job.Filename, model.StateDownloaded, "saved to orders folder"); err != nil {
+				return err
+			}
+			emit(ctx, db, webhooks.EventOrderFileDownloaded, orderFileData(ctx, db, job.Filename))
+			return nil
+		},
+		Failed: func(ctx context.Context, job model.Job, err error, dead bool) {
+			reason := fmt.Sprintf("attempt %d failed, retried later: %v", job.Attempts, err)
+			if dead {
+				reason = fmt.Sprintf("dead-lettered after %d attempts: %v", job.Attempts, err)
+			}
+			if err := model.SetState(ctx, db, job.Filename, model.StateFailed, reason); err != nil {
+				slog.ErrorContext(ctx, "Order file state update error", "file", job.Filename, "error", err)
+			}
+		},
 	}
-	log.Println("Total Files parsed from DB: ", len(parsedFiles))
+}
 
-	// Get all downloaded files from folder
-	filesInFolder := fileutil.GetFileListInFolder(ordersPath)
-	log.Println("Total Files in folder: ", len(filesInFolder))
+// parseHandler extracts the dossiers of a job's order file and moves it to the parsed state,
+// or to needs_ocr if the PDF text has no dossier numbers.
+// A failed attempt moves the file back to downloaded, and to the failed state once the job is dead-lettered.
+func parseHandler(db *sql.DB) jobs.Handler {
+	return jobs.Handler{
+		Handle: func(ctx context.Context, job model.Job) error {
+			reason := fmt.Sprintf("parse job %d, attempt %d", job.ID, job.Attempts)
+			if err := model.SetState(ctx, db, job.Filename, model.StateParsing, reason); err != nil {
+				return err
+			}
 
-	// Get difference between downloaded and parsed
-	for _, fileInFolder := range filesInFolder {
-		isParsed := false
-		for _, fileInDB := range parsedFiles {
-			if fileInFolder == fileInDB {
-				isParsed = true
-				break
+			orders, pages, err := extractors.Parse(cfg.Storage.OrdersPath, job.Filename)
+			if err != nil {
+				return err
 			}
-		}
-		if isParsed {
-			filesToParse = append(filesToParse, fileInFolder)
-		}
+			// Page text for full-text search, replacing the text of an earlier parse
+			if err := model.SavePages(ctx, db, job.Filename, pages); err != nil {
+				return err
+			}
+
+			// save to DB
+			statement, err := db.Prepare(model.Insert_Order_if_new)
+			if err != nil {
+				return fmt.Errorf("error preparing statement: %w", err)
+			}
+			defer statement.Close()
+
+			// Dossiers which can't be saved don't fail the file; dossiers already stored are matched only once
+			count := 0
+			for _, el := range orders {
+				count++
+				res, err := statement.Exec(el.Filename, el.Number, el.Year, el.FullNameFormatted, el.Category)
+				if err != nil {
+					slog.ErrorContext(ctx, "Dossier inserting error", "file", el.Filename, "dossier", el.FullNameFormatted, "error", err)
+					continue
+				}
+				if n, _ := res.RowsAffected(); n == 0 {
+					continue
+				}
+				emit(ctx, db, webhooks.EventDossierMatched, webhooks.DossierData{
+					Dossier: el.FullNameFormatted, Number: el.Number, Year: el.Year, Filename: el.Filename,
+				})
+			}
+			slog.InfoContext(ctx, "Dossiers extracted", "file", job.Filename, "dossiers", count)
 
+			// Files without dossier numbers are probably scans
+			ctx = context.WithoutCancel(ctx)
+			if count == 0 {
+				return model.SetState(ctx, db, job.Filename, model.StateNeedsOCR, "no dossier numbers in PDF text")
+			}
+			if err := model.SetState(ctx, db, job.Filename, model.StateParsed, fmt.Sprintf("%d dossiers extracted", count)); err != nil {
+				return err
+			}
+			data := orderFileData(ctx, db, job.Filename)
+			data.Dossiers = &count
+			emit(ctx, db, webhooks.EventOrderFileParsed, data)
+			return nil
+		},
+		Failed: func(ctx context.Context, job model.Job, err error, dead bool) {
+			state, reason := model.StateDownloaded, fmt.Sprintf("attempt %d failed, retried later: %v", job.Attempts, err)
+			if dead {
+				state, reason = model.StateFailed, fmt.Sprintf("dead-lettered after %d attempts: %v", job.Attempts, err)
+			}
+			if err := model.SetState(ctx, db, job.Filename, state, reason); err != nil {
+				slog.ErrorContext(ctx, "Order file state update error", "file", job.Filename, "error", err)
+			}
+		},
 	}
+}
 
-	orders, err := extractors.Order(ordersPath, filesToParse...)
+// recordFileHash stores the SHA-256 and size of an order file in the orders folder, checked by reconcile
+func recordFileHash(ctx context.Context, db *sql.DB, filename string) error {
+	hash, size, err := fileutil.HashFile(filepath.Join(cfg.Storage.OrdersPath, filename))
 	if err != nil {
-		log.Printf("error:%e\n", err)
+		return fmt.Errorf("error hashing file: %w", err)
 	}
+	_, err = db.ExecContext(ctx, model.Set_Order_File_Hash, hash, size, time.Now().UTC(), filename)
+	if err != nil {
+		return fmt.Errorf("error saving file hash: %w", err)
+	}
+	return nil
+}
 
-	fmt.Println(orders)
+// itemErr returns the error of the only item of a *pipeline.Errors, or err itself
+func itemErr(err error) error {
+	if items, ok := err.(*pipeline.Errors); ok && len(items.Items) == 1 {
+		return items.Items[0].Err
+	}
+	return err
+}
 
-	// save to DB
-	statement, err := db.Prepare(model.Insert_Order)
+// queryURLs returns the filenames of all rows selected by query, keyed by URL.
+// query selects URL and Filename.
+func queryURLs(db *sql.DB, query string, args ...any) (map[string]string, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer statement.Close()
+	defer rows.Close()
 
-	// Execute query with specific parameters
-	for _, el := range orders {
-		_, err := statement.Exec(el.Filename, el.Number, el.Year, el.FullNameFormatted)
-		if err != nil {
-			log.Printf("Error during insert in db %v: %e\n", el, err)
+	result := make(map[string]string)
+	for rows.Next() {
+		var url, filename string
+		if err := rows.Scan(&url, &filename); err != nil {
+			return nil, err
 		}
+		result[url] = filename
 	}
+	return result, rows.Err()
+}
+
+// dataSource returns the SQLite data source name for the database file at path.
+// Several processes (daemon, workers, commands) may use the database at once, so they wait for each other's
+// locks instead of failing, and transactions take the write lock when they begin.
+func dataSource(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=busy_timeout(10000)&_txlock=immediate"
+}
 
-	// Update to DB
-	statement, err = db.Prepare(model.Set_is_Parsed)
+// queryStrings returns the single text column of all rows selected by query
+func queryStrings(db *sql.DB, query string, args ...any) ([]string, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer statement.Close()
+	defer rows.Close()
 
-	// Execute query with specific parameters
-	for _, el := range orders {
-		_, err := statement.Exec(el.Filename)
-		if err != nil {
-			log.Printf("Error during update in db %v: %e\n", el, err)
+	result := make([]string, 0)
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
 		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
+
+// orderFileData reads an order file for a webhook payload; only the filename is set if it can't be read
+func orderFileData(ctx context.Context, db *sql.DB, filename string) webhooks.OrderFileData {
+	data := webhooks.OrderFileData{Filename: filename}
+	f, err := model.ScanOrderFile(db.QueryRowContext(ctx, model.Get_Order_File, filename))
+	if err != nil {
+		slog.ErrorContext(ctx, "Order file reading error", "file", filename, "error", err)
+		return data
 	}
+	data.Date, data.Name, data.URL, data.Source = f.Date, f.Name, f.URL, f.Source
+	return data
 }
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migrations holds the schema changes in the order they were introduced.
+// The index of a migration + 1 is the schema version stored in PRAGMA user_version.
+// Never edit or reorder existing entries, append new ones instead.
+var Migrations = []string{
+	// 1: initial tables
+	CreateOrderFilesDB + CreateOrdersDB,
+	// 2: normalized order dates; Date keeps the raw text from the listing
+	`ALTER TABLE OrderFiles ADD COLUMN OrderDate TEXT;
+	CREATE INDEX IF NOT EXISTS OrderFiles_OrderDate ON OrderFiles (OrderDate);`,
+	// 3: structured order names; Name keeps the raw link text
+	`ALTER TABLE OrderFiles ADD COLUMN OrderNumber INT;
+	ALTER TABLE OrderFiles ADD COLUMN OrderSeries TEXT;
+	CREATE INDEX IF NOT EXISTS OrderFiles_OrderSeries_OrderNumber ON OrderFiles (OrderSeries, OrderNumber);`,
+	// 4: archive of fetched listing pages
+	CreateSnapshotsDB,
+	// 5: listing page each order file was found on; all earlier rows come from the article 11 listing
+	`ALTER TABLE OrderFiles ADD COLUMN Source TEXT NOT NULL DEFAULT '';
+	UPDATE OrderFiles SET Source = 'https://cetatenie.just.ro/ordine-articolul-1-1/' WHERE Source = '';
+	CREATE INDEX IF NOT EXISTS OrderFiles_Source ON OrderFiles (Source);
+	CREATE INDEX IF NOT EXISTS Orders_Filename ON Orders (Filename);`,
+	// 6: outgoing webhooks and their delivery log
+	CreateWebhooksDB,
+	// 7: start, finish and error count of every pipeline stage run
+	CreateStageRunsDB,
+	// 8: pipeline state replaces the IsURLBroken, IsDownloaded and IsParsed flags; existing files start their history
+	// with the state derived from the flags
+	`ALTER TABLE OrderFiles ADD COLUMN State TEXT NOT NULL DEFAULT 'discovered';
+	UPDATE OrderFiles SET State = CASE
+		WHEN IsParsed THEN 'parsed'
+		WHEN IsDownloaded THEN 'downloaded'
+		WHEN IsURLBroken THEN 'broken'
+		ELSE 'discovered'
+	END;
+	CREATE INDEX IF NOT EXISTS OrderFiles_State ON OrderFiles (State);
+	` + CreateOrderFileTransitionsDB + `
+	INSERT INTO OrderFileTransitions (Filename, FromState, ToState, Reason, CreatedAt)
+	SELECT Filename, '', State, 'derived from flags by migration 8', COALESCE(UpdatedAt, CreatedAt, CURRENT_TIMESTAMP) FROM OrderFiles;
+	ALTER TABLE OrderFiles DROP COLUMN IsURLBroken;
+	ALTER TABLE OrderFiles DROP COLUMN IsDownloaded;
+	ALTER TABLE OrderFiles DROP COLUMN IsParsed;`,
+	// 9: leased download and parse jobs
+	CreateJobsDB,
+	// 10: SHA-256 and size of the saved PDF, to detect damaged files
+	`ALTER TABLE OrderFiles ADD COLUMN FileHash TEXT NOT NULL DEFAULT '';
+	ALTER TABLE OrderFiles ADD COLUMN FileSize INT NOT NULL DEFAULT 0;`,
+	// 11: full-text index of the order file pages; files parsed earlier are indexed by search -reindex
+	CreateOrderPagesDB,
+	// 12: dossier category, e.g. RD in 12345/RD/2019; dossiers parsed earlier keep an empty category
+	`ALTER TABLE Orders ADD COLUMN Category TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS Orders_Year_Category ON Orders (Year, Category);`,
+	// 13: time the file hash was recorded, so hashing doesn't move UpdatedAt, the time of the last state transition;
+	// files hashed earlier take the time of their last transition
+	`ALTER TABLE OrderFiles ADD COLUMN HashedAt DATETIME;
+	UPDATE OrderFiles SET HashedAt = UpdatedAt WHERE FileHash != '';`,
+	// 14: the category is part of the unique FullNameFormatted, so 12345/2019 and 12345/RD/2019 are different
+	// dossiers; dossiers parsed before migration 12 get their category from parse -reparse.
+	// Renamed dossiers are updated now, so incremental exports return them under the new name
+	`UPDATE Orders SET FullNameFormatted = Number || '/' || Category || '/' || Year, UpdatedAt = CURRENT_TIMESTAMP
+	WHERE Category != '';`,
+}
+
+// SchemaVersion returns the current schema version of the database
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrate applies all migrations which are not applied yet, each one in its own transaction
+func Migrate(db *sql.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for i := version; i < len(Migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(Migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d: %w", i+1, err)
+		}
+		// PRAGMA doesn't accept placeholders
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error updating schema version to %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
@@ -3,13 +3,17 @@ package model
 import "time"
 
 type OrderFile struct {
-	Date         string    `json:"date"`
+	Date         string    `json:"date"`      // raw date text from the listing, e.g. "26.10.2023"
+	OrderDate    time.Time `json:"orderDate"` // parsed Date, zero if it couldn't be parsed
 	URL          string    `json:"url"`
 	Filename     string    `json:"filename"`
-	Name         string    `json:"name"`
-	IsURLBroken  bool      `json:"isURLBroken"`
-	IsDownloaded bool      `json:"isDownloaded"`
-	IsParsed     bool      `json:"isParsed"`
+	Name         string    `json:"name"`        // raw link text from the listing, e.g. "1795P"
+	OrderNumber  uint      `json:"orderNumber"` // parsed from Name, 0 if it couldn't be parsed
+	OrderSeries  string    `json:"orderSeries"` // parsed from Name, e.g. "P"
+	Source       string    `json:"source"`      // listing page the file was found on
+	State        State     `json:"state"` // pipeline state, UpdatedAt is the time of the last transition
+	FileHash     string    `json:"fileHash"` // SHA-256 of the saved PDF, empty until downloaded
+	FileSize     int64     `json:"fileSize"`
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
@@ -18,13 +22,87 @@ type Order struct {
 	Filename          string       `json:"fileid"`
 	Year              uint    `json:"year"`
 	Number            uint    `json:"number"`
-	FullNameFormatted string    `json:"fullnameformatted"`
+	FullNameFormatted string    `json:"fullnameformatted"` // unique, e.g. "12345/2019" or "12345/RD/2019"
+	Category          string    `json:"category"` // letters between number and year, e.g. "RD"; empty if none or parsed before it was stored and not reparsed
 	CreatedAt         time.Time `json:"createdAt"`
 	UpdatedAt         time.Time `json:"updatedAt"`
 }
 
+// Snapshot is a compressed copy of a fetched listing page
+type Snapshot struct {
+	ID        int64     `json:"id"`
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Hash      string    `json:"hash"`
+	Path      string    `json:"path"`
+	Size      int       `json:"size"`
+}
+
+// Webhook is an outgoing webhook subscription
+type Webhook struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`
+	Events    string    `json:"events"` // comma separated event types, "*" for all
+	IsActive  bool      `json:"isActive"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is a single event sent (or to be sent) to a webhook
+type WebhookDelivery struct {
+	ID             int64     `json:"id"`
+	WebhookID      int64     `json:"webhookId"`
+	Event          string    `json:"event"`
+	Payload        string    `json:"payload"`
+	Status         string    `json:"status"` // pending, delivered or failed
+	Attempts       int       `json:"attempts"`
+	ResponseStatus int       `json:"responseStatus"`
+	LastError      string    `json:"lastError"`
+	NextAttemptAt  time.Time `json:"nextAttemptAt"`
+	CreatedAt      time.Time `json:"createdAt"`
+	URL            string    `json:"url"`
+	Secret         string    `json:"-"`
+}
+
+// StageRun is a single run of a pipeline stage
+type StageRun struct {
+	ID         int64      `json:"id"`
+	RunID      string     `json:"runId"`
+	Stage      string     `json:"stage"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"` // nil while the stage is running or if it was interrupted
+	Errors     int        `json:"errors"`
+	LastError  string     `json:"lastError"`
+}
+
+// Job is a unit of download or parse work on one order file, claimed by one worker at a time
+type Job struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"` // download or parse
+	Filename    string     `json:"filename"`
+	Status      string     `json:"status"` // pending, leased, done or dead
+	Attempts    int        `json:"attempts"`
+	LeaseOwner  string     `json:"leaseOwner"`
+	LeasedUntil *time.Time `json:"leasedUntil"` // nil until the job is first claimed
+	RunAfter    time.Time  `json:"runAfter"`
+	LastError   string     `json:"lastError"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
 // type FilesToDownload struct{
 // 	URL          string    `json:"url"`
 // 	Filename     string    `json:"filename"`
 
 // }
+
+// SearchHit is an order file page matching a full-text search
+type SearchHit struct {
+	Filename  string    `json:"filename"`
+	Page      int       `json:"page"`    // 1-based page number
+	Snippet   string    `json:"snippet"` // text around the matched terms, see Search
+	Name      string    `json:"name"`
+	Date      string    `json:"date"`
+	OrderDate time.Time `json:"orderDate"`
+	URL       string    `json:"url"`
+}
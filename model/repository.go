@@ -23,21 +23,344 @@ const (
 		UpdatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (Filename) REFERENCES OrderFile (Filename) ON DELETE CASCADE
 	)`
-	Insert_Order_File string = `INSERT INTO OrderFiles (Date, URL, Filename, Name) VALUES (?, ?, ?, ?)`
-	Insert_Order      string = `INSERT INTO Orders (Filename, Number, Year, FullNameFormatted) VALUES (?, ?, ?, ?)`
-	Get_new_Filenames string = `SELECT Filename FROM OrderFiles WHERE IsDownloaded = false;`
-	Get_Valid_URLs    string = `SELECT URL FROM OrderFiles WHERE IsURLBroken = false AND IsDownloaded = false;`
-
-	Get_Files_to_download string = `SELECT URL, Filename FROM OrderFiles WHERE IsURLBroken = false AND IsDownloaded = false;`
-	Get_Files_not_parsed  string = `SELECT Filename FROM OrderFiles WHERE IsParsed = false;`
-	//	Get_Files_downloaded_to_parse string = `SELECT Filename FROM OrderFiles WHERE IsParsed = false AND IsDownloaded = true;`
-	Set_broken_URLs string = `UPDATE OrderFiles
-	SET IsURLBroken = true
-	WHERE URL = ?;`
-	Set_is_Downloaded string = `UPDATE OrderFiles
-	SET IsDownloaded = true
+	CreateSnapshotsDB string = `CREATE TABLE IF NOT EXISTS Snapshots
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		Source TEXT NOT NULL,
+		FetchedAt DATETIME NOT NULL,
+		Hash TEXT NOT NULL,
+		Path TEXT NOT NULL,
+		Size INT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS Snapshots_Source_FetchedAt ON Snapshots (Source, FetchedAt);`
+	CreateWebhooksDB string = `CREATE TABLE IF NOT EXISTS Webhooks
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		URL TEXT NOT NULL,
+		Secret TEXT NOT NULL,
+		Events TEXT NOT NULL DEFAULT '*',
+		IsActive BOOLEAN DEFAULT TRUE,
+		CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS WebhookDeliveries
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		WebhookID INTEGER NOT NULL,
+		Event TEXT NOT NULL,
+		Payload TEXT NOT NULL,
+		Status TEXT NOT NULL DEFAULT 'pending',
+		Attempts INT NOT NULL DEFAULT 0,
+		ResponseStatus INT NOT NULL DEFAULT 0,
+		LastError TEXT NOT NULL DEFAULT '',
+		NextAttemptAt DATETIME NOT NULL,
+		DeliveredAt DATETIME,
+		CreatedAt DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (WebhookID) REFERENCES Webhooks (ID) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS WebhookDeliveries_Status_NextAttemptAt ON WebhookDeliveries (Status, NextAttemptAt);`
+	CreateStageRunsDB string = `CREATE TABLE IF NOT EXISTS StageRuns
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		RunID TEXT NOT NULL,
+		Stage TEXT NOT NULL,
+		StartedAt DATETIME NOT NULL,
+		FinishedAt DATETIME,
+		Errors INT NOT NULL DEFAULT 0,
+		LastError TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS StageRuns_Stage ON StageRuns (Stage);`
+	Insert_Order_File string = `INSERT OR IGNORE INTO OrderFiles (Date, URL, Filename, Name, OrderDate, OrderNumber, OrderSeries, Source) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	// A dossier already stored, listed in an earlier order or found by an earlier parse of the file, is left alone
+	Insert_Order_if_new string = `INSERT OR IGNORE INTO Orders (Filename, Number, Year, FullNameFormatted, Category) VALUES (?, ?, ?, ?, ?)`
+	// Category of a dossier stored before categories were, found by parse -reparse in the dossier's own order file
+	Set_Order_Category string = `UPDATE Orders
+	SET Category = ?1, FullNameFormatted = ?2, UpdatedAt = CURRENT_TIMESTAMP
+	WHERE Filename = ?3 AND Number = ?4 AND Year = ?5 AND Category = ''
+		AND NOT EXISTS (SELECT 1 FROM Orders WHERE FullNameFormatted = ?2);`
+
+	CreateOrderFileTransitionsDB string = `CREATE TABLE IF NOT EXISTS OrderFileTransitions
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		Filename TEXT NOT NULL,
+		FromState TEXT NOT NULL,
+		ToState TEXT NOT NULL,
+		Reason TEXT NOT NULL DEFAULT '',
+		CreatedAt DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS OrderFileTransitions_Filename ON OrderFileTransitions (Filename);`
+
+	// Order files by pipeline state, see State for the lifecycle
+	// Failed files are retried by their jobs, see Enqueue_Download_Jobs
+	// Files with an active job are left to the job, which may be writing the file right now
+	Get_Files_not_downloaded string = `SELECT f.Filename FROM OrderFiles f
+	WHERE f.State IN ('discovered', 'verified', 'downloading', 'broken')
+		AND NOT EXISTS (SELECT 1 FROM Jobs j WHERE j.Filename = f.Filename AND j.Status IN ('pending', 'leased'));`
+	Get_URLs_to_verify    string = `SELECT URL, Filename FROM OrderFiles WHERE State = 'discovered';`
+	Get_Files_to_download string = `SELECT Filename FROM OrderFiles WHERE State IN ('discovered', 'verified', 'downloading', 'failed');`
+	Get_Files_to_parse    string = `SELECT Filename FROM OrderFiles WHERE State IN ('downloaded', 'parsing');`
+	Get_Files_parsed      string = `SELECT Filename FROM OrderFiles WHERE State = 'parsed' ORDER BY Filename;`
+	Get_Order_File_State  string = `SELECT State FROM OrderFiles WHERE Filename = ?;`
+	Set_Order_File_State  string = `UPDATE OrderFiles
+	SET State = ?, UpdatedAt = ?
 	WHERE Filename = ?;`
-	Set_is_Parsed string = `UPDATE OrderFiles
-	SET IsParsed = true
+	Insert_Transition           string = `INSERT INTO OrderFileTransitions (Filename, FromState, ToState, Reason, CreatedAt) VALUES (?, ?, ?, ?, ?)`
+	Get_Transitions_by_Filename string = `SELECT ID, Filename, FromState, ToState, Reason, CreatedAt
+	FROM OrderFileTransitions WHERE Filename = ? ORDER BY ID;`
+	Get_Order_Files_per_State string = `SELECT State, COUNT(*) FROM OrderFiles GROUP BY State ORDER BY State;`
+	Set_Order_File_Hash       string = `UPDATE OrderFiles
+	SET FileHash = ?, FileSize = ?, HashedAt = ?
 	WHERE Filename = ?;`
+	// Order files with the existence of an active job, which owns the file meanwhile
+	Get_Order_Files_to_reconcile string = `SELECT f.Filename, f.State, f.FileHash, f.FileSize,
+		EXISTS (SELECT 1 FROM Jobs j WHERE j.Filename = f.Filename AND j.Status IN ('pending', 'leased'))
+	FROM OrderFiles f ORDER BY f.Filename;`
+
+	// Plain text of every order file page, full-text indexed; diacritics are folded so "stefan" finds "Ștefan"
+	CreateOrderPagesDB string = `CREATE VIRTUAL TABLE IF NOT EXISTS OrderPages USING fts5
+	(
+		Filename UNINDEXED,
+		Page UNINDEXED,
+		Text,
+		tokenize = 'unicode61 remove_diacritics 2'
+	);`
+	Delete_Order_Pages string = `DELETE FROM OrderPages WHERE Filename = ?;`
+	Insert_Order_Page  string = `INSERT INTO OrderPages (Filename, Page, Text) VALUES (?, ?, ?)`
+	// Parsed order files whose text isn't indexed yet, e.g. parsed before the index existed
+	Get_Files_to_index string = `SELECT Filename FROM OrderFiles
+	WHERE State IN ('parsed', 'needs_ocr') AND Filename NOT IN (SELECT Filename FROM OrderPages)
+	ORDER BY rowid;`
+	Count_Files_to_index string = `SELECT COUNT(*) FROM OrderFiles
+	WHERE State IN ('parsed', 'needs_ocr') AND Filename NOT IN (SELECT Filename FROM OrderPages);`
+	// Best matches first; ?2 and ?3 enclose the matched terms in the snippet
+	Search_Order_Pages string = `SELECT OrderPages.Filename, OrderPages.Page, snippet(OrderPages, 2, ?2, ?3, '…', 16),
+		f.Name, f.Date, f.OrderDate, f.URL
+	FROM OrderPages JOIN OrderFiles f ON f.Filename = OrderPages.Filename
+	WHERE OrderPages MATCH ?1
+	ORDER BY rank, OrderPages.Filename, OrderPages.Page
+	LIMIT ?4 OFFSET ?5;`
+	Count_Search_Order_Pages string = `SELECT COUNT(*) FROM OrderPages WHERE OrderPages MATCH ?;`
+
+	Get_Raw_Dates_not_parsed string = `SELECT Filename, Date FROM OrderFiles WHERE OrderDate IS NULL ORDER BY Filename;`
+	Set_Order_Date           string = `UPDATE OrderFiles
+	SET OrderDate = ?, UpdatedAt = CURRENT_TIMESTAMP
+	WHERE Filename = ?;`
+	Get_Raw_Names_not_parsed string = `SELECT Filename, Name FROM OrderFiles WHERE OrderNumber IS NULL ORDER BY Filename;`
+	Set_Order_Name           string = `UPDATE OrderFiles
+	SET OrderNumber = ?, OrderSeries = ?, UpdatedAt = CURRENT_TIMESTAMP
+	WHERE Filename = ?;`
+
+	Insert_Snapshot        string = `INSERT INTO Snapshots (Source, FetchedAt, Hash, Path, Size) VALUES (?, ?, ?, ?, ?)`
+	Get_Last_Snapshot_Hash string = `SELECT Hash FROM Snapshots WHERE Source = ? ORDER BY FetchedAt DESC, ID DESC LIMIT 1;`
+	Get_Snapshots          string = `SELECT ID, Source, FetchedAt, Hash, Path, Size FROM Snapshots ORDER BY ID;`
+	Get_Snapshot_by_ID     string = `SELECT ID, Source, FetchedAt, Hash, Path, Size FROM Snapshots WHERE ID = ?;`
+
+	// Read-only lookups. Empty filter values disable the filter.
+	Get_Order_Files_page string = `SELECT Filename, Date, OrderDate, URL, Name, OrderNumber, OrderSeries, Source, State, FileHash, FileSize, CreatedAt, UpdatedAt
+	FROM OrderFiles
+	WHERE (?1 = '' OR OrderDate >= ?1) AND (?2 = '' OR OrderDate <= ?2) AND (?3 = '' OR Source = ?3)
+	ORDER BY OrderDate DESC, OrderSeries, OrderNumber DESC, Filename
+	LIMIT ?4 OFFSET ?5;`
+	Count_Order_Files string = `SELECT COUNT(*) FROM OrderFiles
+	WHERE (?1 = '' OR OrderDate >= ?1) AND (?2 = '' OR OrderDate <= ?2) AND (?3 = '' OR Source = ?3);`
+	Get_Order_File string = `SELECT Filename, Date, OrderDate, URL, Name, OrderNumber, OrderSeries, Source, State, FileHash, FileSize, CreatedAt, UpdatedAt
+	FROM OrderFiles WHERE Filename = ?;`
+	Get_Orders_by_Filename string = `SELECT Filename, Year, Number, FullNameFormatted, Category, CreatedAt, UpdatedAt
+	FROM Orders WHERE Filename = ? ORDER BY Year, Number;`
+	// Dossiers by year and number, the same number and year may be in several categories; an empty category
+	// disables the filter
+	Get_Orders_by_Dossier string = `SELECT Filename, Year, Number, FullNameFormatted, Category, CreatedAt, UpdatedAt
+	FROM Orders WHERE Year = ?1 AND Number = ?2 AND (?3 = '' OR Category = ?3)
+	ORDER BY Category, Filename;`
+	// Dossiers among the "number/year" names given as a JSON array; an empty category disables the filter
+	Get_Orders_by_Dossiers string = `SELECT Filename, Year, Number, FullNameFormatted, Category, CreatedAt, UpdatedAt
+	FROM Orders WHERE Number || '/' || Year IN (SELECT value FROM json_each(?1)) AND (?2 = '' OR Category = ?2);`
+	Get_Order_Files_stats string = `SELECT COUNT(*),
+		COALESCE(SUM(State = 'broken'), 0),
+		COALESCE(SUM(State IN ('downloaded', 'parsing', 'parsed', 'needs_ocr')), 0),
+		COALESCE(SUM(State = 'parsed'), 0),
+		COALESCE(MIN(OrderDate), ''), COALESCE(MAX(OrderDate), '')
+	FROM OrderFiles;`
+	// Dossiers per order date and dossier year for the processing times; empty source and series disable the filter
+	Get_Processing_Times string = `SELECT f.Source, COALESCE(f.OrderSeries, ''), f.OrderDate, o.Year, COUNT(*)
+	FROM Orders o JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE f.OrderDate BETWEEN ?1 AND ?2 AND (?3 = '' OR f.Source = ?3) AND (?4 = '' OR f.OrderSeries = ?4)
+	GROUP BY f.Source, f.OrderSeries, f.OrderDate, o.Year;`
+	// Dossiers of a year with the date of their order, oldest first; an empty category disables the filter
+	Get_Dossiers_by_Year string = `SELECT f.OrderDate, o.Number
+	FROM Orders o JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE o.Year = ?1 AND f.OrderDate IS NOT NULL AND (?2 = '' OR o.Category = ?2)
+	ORDER BY f.OrderDate;`
+	Get_Last_Order_Date string = `SELECT COALESCE(MAX(OrderDate), '') FROM OrderFiles;`
+	// Resolved dossiers per year and category in number order, for gap detection; year 0 selects all years
+	Get_Resolved_Dossiers string = `SELECT o.Year, o.Category, o.Number, o.Filename, COALESCE(f.OrderDate, '')
+	FROM Orders o LEFT JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE ?1 = 0 OR o.Year = ?1
+	ORDER BY o.Year, o.Category, o.Number;`
+	// First page whose text matches an FTS5 query
+	Find_Order_Page string = `SELECT Filename, Page FROM OrderPages WHERE OrderPages MATCH ? ORDER BY rank LIMIT 1;`
+	// Order files dated within a range which aren't parsed, so their dossiers may be missing
+	Get_Unparsed_Order_Files_between string = `SELECT Filename, State FROM OrderFiles
+	WHERE State != 'parsed' AND OrderDate BETWEEN ?1 AND ?2
+	ORDER BY OrderDate, Filename;`
+	// Monthly counts for the report charts, months as YYYY-MM from the month of ?1 on
+	Get_Order_Files_per_Month string = `SELECT substr(OrderDate, 1, 7) AS Month, COUNT(*) FROM OrderFiles
+	WHERE OrderDate >= ?1
+	GROUP BY Month ORDER BY Month;`
+	Get_Dossiers_per_Month string = `SELECT substr(f.OrderDate, 1, 7) AS Month, COUNT(*)
+	FROM Orders o JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE f.OrderDate >= ?1
+	GROUP BY Month ORDER BY Month;`
+	// Highest dossier number of every dossier year resolved by the orders of a month
+	Get_Front_per_Month string = `SELECT substr(f.OrderDate, 1, 7) AS Month, o.Year, MAX(o.Number)
+	FROM Orders o JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE f.OrderDate >= ?1
+	GROUP BY Month, o.Year ORDER BY Month, o.Year;`
+	// Export queries: ?1 watermark "YYYY-MM-DD HH:MM:SS", rows changed at or after it, '' for all rows;
+	// ?2 source, ?3 and ?4 order date range, '' for no limit; ?5 dossier year, 0 for all years.
+	// Timestamps are cut to seconds since CURRENT_TIMESTAMP and Go times are stored in different formats.
+	Export_Order_Files string = `SELECT f.Filename, f.Date, f.OrderDate, f.URL, f.Name, f.OrderNumber, f.OrderSeries,
+		f.Source, f.State, f.FileHash, f.FileSize, (SELECT COUNT(*) FROM Orders o WHERE o.Filename = f.Filename),
+		substr(f.CreatedAt, 1, 19), max(substr(f.UpdatedAt, 1, 19), COALESCE(substr(f.HashedAt, 1, 19), '')) AS Updated
+	FROM OrderFiles f
+	WHERE (?1 = '' OR max(substr(f.UpdatedAt, 1, 19), COALESCE(substr(f.HashedAt, 1, 19), '')) >= ?1)
+		AND (?2 = '' OR f.Source = ?2)
+		AND (?3 = '' OR f.OrderDate >= ?3) AND (?4 = '' OR f.OrderDate <= ?4)
+		AND (?5 = 0 OR EXISTS (SELECT 1 FROM Orders o WHERE o.Filename = f.Filename AND o.Year = ?5))
+	ORDER BY Updated, f.Filename;`
+	Export_Orders string = `SELECT o.Filename, o.FullNameFormatted, o.Number, o.Year, o.Category,
+		substr(o.CreatedAt, 1, 19), substr(o.UpdatedAt, 1, 19) AS Updated
+	FROM Orders o LEFT JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE (?1 = '' OR substr(o.UpdatedAt, 1, 19) >= ?1) AND (?2 = '' OR f.Source = ?2)
+		AND (?3 = '' OR f.OrderDate >= ?3) AND (?4 = '' OR f.OrderDate <= ?4) AND (?5 = 0 OR o.Year = ?5)
+	ORDER BY Updated, o.FullNameFormatted;`
+	// A dossier occurrence is a dossier with the order file it was found in; it changes with either of them
+	Export_Occurrences string = `SELECT o.FullNameFormatted, o.Number, o.Year, o.Category, o.Filename, f.OrderDate,
+		f.OrderNumber, f.OrderSeries, f.Source, f.URL,
+		max(substr(o.UpdatedAt, 1, 19), COALESCE(substr(f.UpdatedAt, 1, 19), '')) AS Updated
+	FROM Orders o LEFT JOIN OrderFiles f ON f.Filename = o.Filename
+	WHERE (?1 = '' OR max(substr(o.UpdatedAt, 1, 19), COALESCE(substr(f.UpdatedAt, 1, 19), '')) >= ?1)
+		AND (?2 = '' OR f.Source = ?2) AND (?3 = '' OR f.OrderDate >= ?3) AND (?4 = '' OR f.OrderDate <= ?4)
+		AND (?5 = 0 OR o.Year = ?5)
+	ORDER BY Updated, o.FullNameFormatted;`
+	Get_Orders_per_Year        string = `SELECT Year, COUNT(*) FROM Orders GROUP BY Year ORDER BY Year;`
+	Get_Order_Files_per_Source string = `SELECT Source, COUNT(*) FROM OrderFiles GROUP BY Source ORDER BY Source;`
+	// Newest order files first, with the number of dossiers parsed from each; year 0 disables the dossier year filter
+	Get_Feed_Order_Files string = `SELECT f.Filename, f.Date, f.OrderDate, f.URL, f.Name, f.OrderNumber, f.OrderSeries, f.Source,
+		f.State, f.FileHash, f.FileSize, f.CreatedAt, f.UpdatedAt,
+		(SELECT COUNT(*) FROM Orders o WHERE o.Filename = f.Filename)
+	FROM OrderFiles f
+	WHERE ?1 = 0 OR EXISTS (SELECT 1 FROM Orders o WHERE o.Filename = f.Filename AND o.Year = ?1)
+	ORDER BY f.CreatedAt DESC, f.rowid DESC
+	LIMIT ?2;`
+
+	Insert_Webhook             string = `INSERT INTO Webhooks (URL, Secret, Events) VALUES (?, ?, ?)`
+	Delete_Webhook             string = `DELETE FROM Webhooks WHERE ID = ?;`
+	Get_Webhooks               string = `SELECT ID, URL, Secret, Events, IsActive, CreatedAt FROM Webhooks ORDER BY ID;`
+	Get_Active_Webhooks        string = `SELECT ID, URL, Secret, Events, IsActive, CreatedAt FROM Webhooks WHERE IsActive = true ORDER BY ID;`
+	Insert_Webhook_Delivery    string = `INSERT INTO WebhookDeliveries (WebhookID, Event, Payload, NextAttemptAt) VALUES (?, ?, ?, ?)`
+	Get_Due_Webhook_Deliveries string = `SELECT d.ID, d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, d.ResponseStatus, d.LastError, d.NextAttemptAt, d.CreatedAt, w.URL, w.Secret
+	FROM WebhookDeliveries d JOIN Webhooks w ON w.ID = d.WebhookID
+	WHERE d.Status = 'pending' AND d.NextAttemptAt <= ?
+	ORDER BY d.ID;`
+	Get_Webhook_Deliveries string = `SELECT d.ID, d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, d.ResponseStatus, d.LastError, d.NextAttemptAt, d.CreatedAt, w.URL, w.Secret
+	FROM WebhookDeliveries d JOIN Webhooks w ON w.ID = d.WebhookID
+	ORDER BY d.ID DESC
+	LIMIT ?;`
+	Set_Webhook_Delivery_Result string = `UPDATE WebhookDeliveries
+	SET Status = ?, Attempts = Attempts + 1, ResponseStatus = ?, LastError = ?, NextAttemptAt = ?,
+		DeliveredAt = CASE WHEN ? = 'delivered' THEN CURRENT_TIMESTAMP ELSE DeliveredAt END
+	WHERE ID = ?;`
+	Set_Webhook_Delivery_pending string = `UPDATE WebhookDeliveries
+	SET Status = 'pending', Attempts = 0, LastError = '', NextAttemptAt = ?
+	WHERE ID = ?;`
+
+	Get_Pending_per_Stage string = `SELECT
+		COALESCE(SUM(State IN ('discovered', 'verified', 'downloading', 'failed')), 0),
+		COALESCE(SUM(State IN ('downloaded', 'parsing')), 0),
+		COALESCE(SUM(State = 'broken'), 0),
+		COALESCE(SUM(State = 'needs_ocr'), 0)
+	FROM OrderFiles;`
+
+	Insert_Stage_Run       string = `INSERT INTO StageRuns (RunID, Stage, StartedAt) VALUES (?, ?, ?)`
+	Set_Stage_Run_finished string = `UPDATE StageRuns
+	SET FinishedAt = ?, Errors = ?, LastError = ?
+	WHERE ID = ?;`
+	// Latest run of every stage
+	Get_Last_Stage_Runs string = `SELECT ID, RunID, Stage, StartedAt, FinishedAt, Errors, LastError FROM StageRuns
+	WHERE ID IN (SELECT MAX(ID) FROM StageRuns GROUP BY Stage)
+	ORDER BY ID;`
+	// All stages of the latest run
+	Get_Last_Run_Stages string = `SELECT ID, RunID, Stage, StartedAt, FinishedAt, Errors, LastError FROM StageRuns
+	WHERE RunID = (SELECT RunID FROM StageRuns ORDER BY ID DESC LIMIT 1)
+	ORDER BY ID;`
+	Get_Pending_Webhook_Deliveries string = `SELECT ID FROM WebhookDeliveries WHERE Status = 'pending';`
+
+	CreateJobsDB string = `CREATE TABLE IF NOT EXISTS Jobs
+	(
+		ID INTEGER PRIMARY KEY AUTOINCREMENT,
+		Kind TEXT NOT NULL,
+		Filename TEXT NOT NULL,
+		Status TEXT NOT NULL DEFAULT 'pending',
+		Attempts INT NOT NULL DEFAULT 0,
+		LeaseOwner TEXT NOT NULL DEFAULT '',
+		LeasedUntil DATETIME,
+		RunAfter DATETIME NOT NULL,
+		LastError TEXT NOT NULL DEFAULT '',
+		CreatedAt DATETIME NOT NULL,
+		UpdatedAt DATETIME NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS Jobs_Kind_Filename_active ON Jobs (Kind, Filename) WHERE Status IN ('pending', 'leased');
+	CREATE INDEX IF NOT EXISTS Jobs_Status_RunAfter ON Jobs (Status, RunAfter);
+	CREATE INDEX IF NOT EXISTS Jobs_Filename ON Jobs (Filename);`
+	// A file gets no new download job while it has an active or dead-lettered job of any kind, dead jobs are
+	// retried by hand. Dead jobs don't block parsing, as they leave their file in the failed state.
+	Enqueue_Download_Jobs string = `INSERT OR IGNORE INTO Jobs (Kind, Filename, RunAfter, CreatedAt, UpdatedAt)
+	SELECT 'download', f.Filename, ?1, ?1, ?1 FROM OrderFiles f
+	WHERE f.State IN ('discovered', 'verified', 'downloading', 'failed')
+		AND NOT EXISTS (SELECT 1 FROM Jobs j WHERE j.Filename = f.Filename AND j.Status IN ('pending', 'leased', 'dead'))
+	ORDER BY f.rowid;`
+	Enqueue_Parse_Jobs string = `INSERT OR IGNORE INTO Jobs (Kind, Filename, RunAfter, CreatedAt, UpdatedAt)
+	SELECT 'parse', f.Filename, ?1, ?1, ?1 FROM OrderFiles f
+	WHERE f.State IN ('downloaded', 'parsing')
+		AND NOT EXISTS (SELECT 1 FROM Jobs j WHERE j.Filename = f.Filename AND j.Status IN ('pending', 'leased'))
+	ORDER BY f.rowid;`
+	Insert_Job string = `INSERT OR IGNORE INTO Jobs (Kind, Filename, RunAfter, CreatedAt, UpdatedAt) VALUES (?1, ?2, ?3, ?3, ?3)`
+	// Claims the oldest due job of a kind: pending jobs past RunAfter and leased jobs whose lease expired.
+	// A single statement, so two workers never claim the same job.
+	Claim_Job string = `UPDATE Jobs
+	SET Status = 'leased', LeaseOwner = ?1, LeasedUntil = ?2, Attempts = Attempts + 1, UpdatedAt = ?3
+	WHERE ID = (SELECT ID FROM Jobs
+		WHERE Kind = ?4 AND ((Status = 'pending' AND RunAfter <= ?3) OR (Status = 'leased' AND LeasedUntil <= ?3))
+		ORDER BY RunAfter, ID
+		LIMIT 1)
+	RETURNING ID, Kind, Filename, Status, Attempts, LeaseOwner, LeasedUntil, RunAfter, LastError, CreatedAt, UpdatedAt;`
+	// Leased jobs whose lease expired on their last attempt, e.g. because the worker crashed
+	Dead_letter_expired_Jobs string = `UPDATE Jobs
+	SET Status = 'dead', LastError = 'lease expired on attempt ' || Attempts, UpdatedAt = ?1
+	WHERE Kind = ?2 AND Status = 'leased' AND LeasedUntil <= ?1 AND Attempts >= ?3
+	RETURNING ID, Kind, Filename, Status, Attempts, LeaseOwner, LeasedUntil, RunAfter, LastError, CreatedAt, UpdatedAt;`
+	// Lease updates only apply while the worker still holds the lease
+	Extend_Job_Lease string = `UPDATE Jobs
+	SET LeasedUntil = ?, UpdatedAt = ?
+	WHERE ID = ? AND Status = 'leased' AND LeaseOwner = ?;`
+	Set_Job_done string = `UPDATE Jobs
+	SET Status = 'done', LastError = '', UpdatedAt = ?
+	WHERE ID = ? AND Status = 'leased' AND LeaseOwner = ?;`
+	Set_Job_failed string = `UPDATE Jobs
+	SET Status = ?, LastError = ?, RunAfter = ?, UpdatedAt = ?
+	WHERE ID = ? AND Status = 'leased' AND LeaseOwner = ?;`
+	// An interrupted attempt is given back without counting it
+	Set_Job_released string = `UPDATE Jobs
+	SET Status = 'pending', Attempts = Attempts - 1, LeaseOwner = '', RunAfter = ?1, UpdatedAt = ?1
+	WHERE ID = ?2 AND Status = 'leased' AND LeaseOwner = ?3;`
+	Set_Job_pending string = `UPDATE Jobs
+	SET Status = 'pending', Attempts = 0, LeaseOwner = '', RunAfter = ?1, UpdatedAt = ?1
+	WHERE ID = ?2 AND Status = 'dead';`
+	// Empty status selects all jobs
+	Get_Jobs string = `SELECT ID, Kind, Filename, Status, Attempts, LeaseOwner, LeasedUntil, RunAfter, LastError, CreatedAt, UpdatedAt
+	FROM Jobs WHERE ?1 = '' OR Status = ?1
+	ORDER BY ID DESC
+	LIMIT ?2;`
+	Get_Active_Jobs string = `SELECT ID FROM Jobs WHERE Status IN ('pending', 'leased');`
+	Get_Dead_Jobs   string = `SELECT ID FROM Jobs WHERE Status = 'dead';`
 )
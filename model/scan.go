@@ -0,0 +1,70 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Scanner is implemented by *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// ScanOrderFile scans a row selected with the OrderFiles column list used by Get_Order_File
+// (Filename, Date, OrderDate, URL, Name, OrderNumber, OrderSeries, Source, State, FileHash, FileSize, CreatedAt, UpdatedAt)
+func ScanOrderFile(row Scanner) (OrderFile, error) {
+	var (
+		f           OrderFile
+		orderDate   sql.NullString
+		orderNumber sql.NullInt64
+		orderSeries sql.NullString
+	)
+
+	err := row.Scan(&f.Filename, &f.Date, &orderDate, &f.URL, &f.Name, &orderNumber, &orderSeries, &f.Source,
+		&f.State, &f.FileHash, &f.FileSize, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return f, err
+	}
+
+	// NULL columns stay zero
+	if orderDate.Valid {
+		f.OrderDate, _ = time.Parse("2006-01-02", orderDate.String)
+	}
+	f.OrderNumber = uint(orderNumber.Int64)
+	f.OrderSeries = orderSeries.String
+
+	return f, nil
+}
+
+// ScanOrder scans a row selected with the Orders column list used by Get_Orders_by_Filename
+// (Filename, Year, Number, FullNameFormatted, Category, CreatedAt, UpdatedAt)
+func ScanOrder(row Scanner) (Order, error) {
+	var o Order
+	err := row.Scan(&o.Filename, &o.Year, &o.Number, &o.FullNameFormatted, &o.Category, &o.CreatedAt, &o.UpdatedAt)
+	return o, err
+}
+
+// ScanStageRun scans a row selected with the StageRuns column list used by Get_Last_Stage_Runs
+// (ID, RunID, Stage, StartedAt, FinishedAt, Errors, LastError)
+func ScanStageRun(row Scanner) (StageRun, error) {
+	var r StageRun
+	var finishedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.RunID, &r.Stage, &r.StartedAt, &finishedAt, &r.Errors, &r.LastError)
+	if finishedAt.Valid {
+		r.FinishedAt = &finishedAt.Time
+	}
+	return r, err
+}
+
+// ScanJob scans a row selected with the Jobs column list used by Get_Jobs
+// (ID, Kind, Filename, Status, Attempts, LeaseOwner, LeasedUntil, RunAfter, LastError, CreatedAt, UpdatedAt)
+func ScanJob(row Scanner) (Job, error) {
+	var j Job
+	var leasedUntil sql.NullTime
+	err := row.Scan(&j.ID, &j.Kind, &j.Filename, &j.Status, &j.Attempts, &j.LeaseOwner, &leasedUntil, &j.RunAfter,
+		&j.LastError, &j.CreatedAt, &j.UpdatedAt)
+	if leasedUntil.Valid {
+		j.LeasedUntil = &leasedUntil.Time
+	}
+	return j, err
+}
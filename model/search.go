@@ -0,0 +1,100 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Markers enclosing the matched terms in SearchHit.Snippet, replaced by the caller with its own highlighting
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SavePages replaces the indexed text of an order file with pages, page N being pages[N-1]
+func SavePages(ctx context.Context, db *sql.DB, filename string, pages []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, Delete_Order_Pages, filename); err != nil {
+		return fmt.Errorf("error deleting pages of %s: %w", filename, err)
+	}
+	// Empty pages are kept too, so scans count as indexed
+	for i, text := range pages {
+		if _, err := tx.ExecContext(ctx, Insert_Order_Page, filename, i+1, text); err != nil {
+			return fmt.Errorf("error indexing page %d of %s: %w", i+1, filename, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// MatchQuery turns search text into an FTS5 query matching pages which contain all of its terms.
+// FTS5 matches whole tokens, so every term is made a prefix query ("1234"*): 1234 finds 12345 and "popesc" finds
+// Popescu. Outside double quotes each word is a separate term, so 12345/20 finds pages with 12345 and a word
+// starting with 20 anywhere; text in double quotes matches as a phrase whose last word is a prefix, so "12345/20"
+// finds 12345/2019 but not 12345/RD/2019. Punctuation only separates terms, so the text can't produce an invalid
+// query. Returns "" if the text has no letters or digits.
+func MatchQuery(text string) string {
+	separator := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }
+
+	var terms []string
+	for i, part := range strings.Split(text, `"`) {
+		tokens := strings.FieldsFunc(part, separator)
+		if len(tokens) == 0 {
+			continue
+		}
+		// Odd parts are inside double quotes
+		if i%2 == 1 {
+			terms = append(terms, `"`+strings.Join(tokens, " ")+`"*`)
+			continue
+		}
+		for _, token := range tokens {
+			terms = append(terms, `"`+token+`"*`)
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// Search returns the order file pages matching text, best matches first, and the total number of matching pages.
+// Snippets have their whitespace collapsed and the matched terms enclosed in HighlightStart and HighlightEnd.
+func Search(ctx context.Context, db *sql.DB, text string, limit, offset int) ([]SearchHit, int, error) {
+	hits := make([]SearchHit, 0)
+	match := MatchQuery(text)
+	if match == "" {
+		return hits, 0, nil
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, Count_Search_Order_Pages, match).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, Search_Order_Pages, match, HighlightStart, HighlightEnd, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error searching pages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hit       SearchHit
+			orderDate sql.NullString
+		)
+		if err := rows.Scan(&hit.Filename, &hit.Page, &hit.Snippet, &hit.Name, &hit.Date, &orderDate, &hit.URL); err != nil {
+			return nil, 0, fmt.Errorf("error scanning search result: %w", err)
+		}
+		hit.Snippet = strings.Join(strings.Fields(hit.Snippet), " ")
+		if orderDate.Valid {
+			hit.OrderDate, _ = time.Parse("2006-01-02", orderDate.String)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, total, rows.Err()
+}
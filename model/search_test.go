@@ -0,0 +1,82 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestMatchQuery(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{text: "1234", want: `"1234"*`},
+		{text: "12345/20", want: `"12345"* AND "20"*`},
+		{text: `"12345/20"`, want: `"12345 20"*`},
+		{text: `popesc "ion vasile" 2019`, want: `"popesc"* AND "ion vasile"* AND "2019"*`},
+		{text: `"unclosed`, want: `"unclosed"*`},
+		{text: `" / "`, want: ""},
+	}
+	for _, tt := range tests {
+		if got := MatchQuery(tt.text); got != tt.want {
+			t.Errorf("MatchQuery(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	pages := map[string]string{
+		"ordin-1.pdf": "Popescu Ion (12345/2019)",
+		"ordin-2.pdf": "Ionescu Maria (12345/RD/2019)",
+		"ordin-3.pdf": "Vasilescu Ana (54321/2020)",
+	}
+	for filename, text := range pages {
+		_, err := db.Exec(Insert_Order_File, "2023-05-17", "https://example.com/"+filename, filename, "Ordin", "2023-05-17", 100, "P", "https://example.com/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SavePages(ctx, db, filename, []string{text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		text  string
+		files []string
+	}{
+		{text: "1234", files: []string{"ordin-1.pdf", "ordin-2.pdf"}},
+		{text: "12345/20", files: []string{"ordin-1.pdf", "ordin-2.pdf"}},
+		{text: `"12345/20"`, files: []string{"ordin-1.pdf"}},
+		{text: `"12345 rd"`, files: []string{"ordin-2.pdf"}},
+		{text: "popesc", files: []string{"ordin-1.pdf"}},
+		{text: "2345", files: []string{}},
+	}
+	for _, tt := range tests {
+		hits, total, err := Search(ctx, db, tt.text, 10, 0)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.text, err)
+		}
+		files := make([]string, 0)
+		for _, hit := range hits {
+			files = append(files, hit.Filename)
+		}
+		slices.Sort(files)
+		if !slices.Equal(files, tt.files) || total != len(tt.files) {
+			t.Errorf("Search(%q) = %v, total %d, want %v", tt.text, files, total, tt.files)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is the lifecycle state of an order file
+type State string
+
+const (
+	StateDiscovered  State = "discovered"  // found on a listing page
+	StateVerified    State = "verified"    // URL answered a ping
+	StateDownloading State = "downloading" // download in progress
+	StateDownloaded  State = "downloaded"  // PDF saved in the orders folder
+	StateParsing     State = "parsing"     // dossier extraction in progress
+	StateParsed      State = "parsed"      // dossiers extracted
+	StateFailed      State = "failed"      // download or parsing failed, retried by its job
+	StateBroken      State = "broken"      // URL doesn't answer
+	StateNeedsOCR    State = "needs_ocr"   // PDF has no extractable dossier numbers, e.g. a scan
+)
+
+// States lists all states in lifecycle order
+var States = []State{StateDiscovered, StateVerified, StateDownloading, StateDownloaded, StateParsing, StateParsed,
+	StateFailed, StateBroken, StateNeedsOCR}
+
+// transitions lists the states each state can move to
+var transitions = map[State][]State{
+	StateDiscovered:  {StateVerified, StateBroken, StateDownloading, StateDownloaded},
+	StateVerified:    {StateBroken, StateDownloading, StateDownloaded},
+	StateDownloading: {StateDownloaded, StateFailed},
+	StateDownloaded:  {StateParsing, StateFailed},
+	StateParsing:     {StateParsed, StateNeedsOCR, StateFailed, StateDownloaded},
+	StateParsed:      {StateParsing, StateFailed},
+	StateFailed:      {StateVerified, StateBroken, StateDownloading, StateDownloaded, StateParsing},
+	StateBroken:      {StateVerified, StateDownloading, StateDownloaded},
+	StateNeedsOCR:    {StateParsing, StateParsed, StateFailed},
+}
+
+// CanTransition reports whether a file in state s can move to state to
+func (s State) CanTransition(to State) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrInvalidTransition is returned by SetState for moves the state machine doesn't allow
+var ErrInvalidTransition = errors.New("invalid state transition")
+
+// Transition is a recorded state change of an order file
+type Transition struct {
+	ID        int64     `json:"id"`
+	Filename  string    `json:"filename"`
+	FromState State     `json:"from"` // empty for the discovery of the file
+	ToState   State     `json:"to"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// SetState moves an order file to state to, recording the transition with its reason and updating UpdatedAt.
+// Moving to the current state does nothing. Returns ErrInvalidTransition for moves the state machine doesn't allow
+// and sql.ErrNoRows for unknown files.
+func SetState(ctx context.Context, db *sql.DB, filename string, to State, reason string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var from State
+	if err := tx.QueryRowContext(ctx, Get_Order_File_State, filename).Scan(&from); err != nil {
+		return fmt.Errorf("error reading state of %s: %w", filename, err)
+	}
+	if from == to {
+		return nil
+	}
+	if !from.CanTransition(to) {
+		return fmt.Errorf("%s: %s -> %s: %w", filename, from, to, ErrInvalidTransition)
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.ExecContext(ctx, Set_Order_File_State, to, now, filename); err != nil {
+		return fmt.Errorf("error updating state of %s: %w", filename, err)
+	}
+	if _, err := tx.ExecContext(ctx, Insert_Transition, filename, from, to, reason, now); err != nil {
+		return fmt.Errorf("error recording transition of %s: %w", filename, err)
+	}
+	return tx.Commit()
+}
+
+// RecordDiscovery records the initial transition of a newly inserted order file
+func RecordDiscovery(ctx context.Context, db *sql.DB, filename, source string) error {
+	_, err := db.ExecContext(ctx, Insert_Transition, filename, "", StateDiscovered, "found on "+source, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error recording discovery of %s: %w", filename, err)
+	}
+	return nil
+}
+
+// ScanTransition scans a row selected with the OrderFileTransitions column list used by Get_Transitions_by_Filename
+// (ID, Filename, FromState, ToState, Reason, CreatedAt)
+func ScanTransition(row Scanner) (Transition, error) {
+	var t Transition
+	err := row.Scan(&t.ID, &t.Filename, &t.FromState, &t.ToState, &t.Reason, &t.CreatedAt)
+	return t, err
+}
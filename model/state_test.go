@@ -0,0 +1,146 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// transitionsOf returns the recorded transitions of filename as "from>to: reason"
+func transitionsOf(t *testing.T, db *sql.DB, filename string) []string {
+	t.Helper()
+	rows, err := db.Query(Get_Transitions_by_Filename, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	history := make([]string, 0)
+	for rows.Next() {
+		tr, err := ScanTransition(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		history = append(history, string(tr.FromState)+">"+string(tr.ToState)+": "+tr.Reason)
+	}
+	return history
+}
+
+func TestSetState(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.Exec(Insert_Order_File, "2023-05-17", "https://example.com/ordin.pdf", "ordin.pdf", "Ordin", "2023-05-17", 100, "P", "https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RecordDiscovery(ctx, db, "ordin.pdf", "https://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Steps are applied in order to the same file
+	tests := []struct {
+		to      State
+		reason  string
+		wantErr error
+		state   State // state after the step
+	}{
+		{to: StateParsed, reason: "skipping ahead", wantErr: ErrInvalidTransition, state: StateDiscovered},
+		{to: StateVerified, reason: "URL answered", state: StateVerified},
+		{to: StateVerified, reason: "URL answered again", state: StateVerified},
+		{to: StateDownloading, reason: "download job 1", state: StateDownloading},
+		{to: StateParsing, reason: "not downloaded", wantErr: ErrInvalidTransition, state: StateDownloading},
+		{to: StateDownloaded, reason: "saved", state: StateDownloaded},
+		{to: StateParsing, reason: "parse job 2", state: StateParsing},
+		{to: StateNeedsOCR, reason: "no dossier numbers", state: StateNeedsOCR},
+		{to: StateDiscovered, reason: "back to the start", wantErr: ErrInvalidTransition, state: StateNeedsOCR},
+		{to: StateParsing, reason: "parse job 3", state: StateParsing},
+		{to: StateParsed, reason: "2 dossiers extracted", state: StateParsed},
+	}
+	for _, tt := range tests {
+		err := SetState(ctx, db, "ordin.pdf", tt.to, tt.reason)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("SetState(%s) = %v, want %v", tt.to, err, tt.wantErr)
+		}
+		var state State
+		if err := db.QueryRow(Get_Order_File_State, "ordin.pdf").Scan(&state); err != nil {
+			t.Fatal(err)
+		}
+		if state != tt.state {
+			t.Errorf("after SetState(%s): state %s, want %s", tt.to, state, tt.state)
+		}
+	}
+
+	// Only allowed moves to another state are recorded
+	want := []string{
+		">discovered: found on https://example.com/",
+		"discovered>verified: URL answered",
+		"verified>downloading: download job 1",
+		"downloading>downloaded: saved",
+		"downloaded>parsing: parse job 2",
+		"parsing>needs_ocr: no dossier numbers",
+		"needs_ocr>parsing: parse job 3",
+		"parsing>parsed: 2 dossiers extracted",
+	}
+	if got := transitionsOf(t, db, "ordin.pdf"); !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions = %q, want %q", got, want)
+	}
+
+	if err := SetState(ctx, db, "missing.pdf", StateVerified, "unknown file"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetState of an unknown file = %v, want %v", err, sql.ErrNoRows)
+	}
+	if got := transitionsOf(t, db, "missing.pdf"); len(got) != 0 {
+		t.Errorf("transitions of an unknown file = %q, want none", got)
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to State
+		want     bool
+	}{
+		{from: StateDiscovered, to: StateVerified, want: true},
+		{from: StateDiscovered, to: StateDownloaded, want: true},
+		{from: StateDownloading, to: StateFailed, want: true},
+		{from: StateFailed, to: StateDownloading, want: true},
+		{from: StateBroken, to: StateVerified, want: true},
+		{from: StateDiscovered, to: StateParsed},
+		{from: StateParsed, to: StateDiscovered},
+		{from: StateDownloaded, to: StateBroken},
+		{from: StateBroken, to: StateParsing},
+		{from: State("unknown"), to: StateVerified},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s.CanTransition(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	// Every state can be left and every state but discovered can be reached
+	reached := make(map[State]bool)
+	for _, s := range States {
+		if len(transitions[s]) == 0 {
+			t.Errorf("%s has no transitions", s)
+		}
+		for _, to := range transitions[s] {
+			reached[to] = true
+		}
+	}
+	for _, s := range States {
+		if s != StateDiscovered && !reached[s] {
+			t.Errorf("%s can't be reached", s)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"romaniabot/model"
+	"romaniabot/pkg/extractors"
+)
+
+// nullOrderNumber converts an order number to its database form, NULL for an unparsed number
+func nullOrderNumber(n uint) sql.NullInt64 {
+	if n == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(n), Valid: true}
+}
+
+// Names re-parses raw order names which have no order number yet and lists those which still can't be parsed
+func Names(db *sql.DB) error {
+	updated, unparsed, err := backfill(db, model.Get_Raw_Names_not_parsed, model.Set_Order_Name,
+		func(raw string) ([]any, error) {
+			orderName, err := extractors.ParseOrderName(raw)
+			return []any{nullOrderNumber(orderName.Number), orderName.Series}, err
+		})
+	if err != nil {
+		return fmt.Errorf("error normalizing names: %w", err)
+	}
+	slog.Info("Names normalized", "count", updated, "to_review", unparsed)
+	return nil
+}
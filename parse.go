@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"romaniabot/model"
+	"romaniabot/pkg/extractors"
+	"romaniabot/pkg/pipeline"
+	"romaniabot/pkg/webhooks"
+)
+
+// Parse parses the downloaded order files, or re-extracts the dossiers of the parsed ones with -reparse
+func Parse(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	again := flags.Bool("reparse", false, "re-extract the dossiers of parsed order files, storing missing categories")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *again {
+		return reparse(ctx, db)
+	}
+	return ParsePDF(ctx, db)
+}
+
+// reparse extracts the dossiers of every parsed order file again. Dossiers stored before categories were get their
+// category, and dossiers which weren't stored because their number/year was taken by a dossier of another category
+// are added. Dossiers are categorized before any is added, so an added dossier can't take the name of one which
+// is only categorized later. Order files which can't be read are returned as a *pipeline.Errors.
+func reparse(ctx context.Context, db *sql.DB) error {
+	filenames, err := queryStrings(db, model.Get_Files_parsed)
+	if err != nil {
+		return fmt.Errorf("error reading parsed files: %w", err)
+	}
+
+	var (
+		failed pipeline.Errors
+		orders []model.Order
+	)
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		found, _, err := extractors.Parse(cfg.Storage.OrdersPath, filename)
+		if err != nil {
+			failed.Add(pipeline.FileError(filename, err))
+			continue
+		}
+		orders = append(orders, found...)
+	}
+
+	categorized := 0
+	for _, el := range orders {
+		if el.Category == "" {
+			continue
+		}
+		res, err := db.ExecContext(ctx, model.Set_Order_Category, el.Category, el.FullNameFormatted, el.Filename, el.Number, el.Year)
+		if err != nil {
+			failed.Add(pipeline.FileError(el.Filename, fmt.Errorf("error categorizing dossier %s: %w", el.FullNameFormatted, err)))
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			categorized++
+		}
+	}
+
+	added := 0
+	for _, el := range orders {
+		res, err := db.ExecContext(ctx, model.Insert_Order_if_new, el.Filename, el.Number, el.Year, el.FullNameFormatted, el.Category)
+		if err != nil {
+			failed.Add(pipeline.FileError(el.Filename, fmt.Errorf("error adding dossier %s: %w", el.FullNameFormatted, err)))
+			continue
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added++
+			emit(ctx, db, webhooks.EventDossierMatched, webhooks.DossierData{
+				Dossier: el.FullNameFormatted, Number: el.Number, Year: el.Year, Filename: el.Filename,
+			})
+		}
+	}
+
+	slog.InfoContext(ctx, "Order files reparsed", "files", len(filenames), "categorized", categorized, "added", added)
+	return failed.Err()
+}
@@ -0,0 +1,502 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/dossier"
+	"romaniabot/pkg/stats"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// Page is a paginated list response
+type Page[T any] struct {
+	Items   []T `json:"items"`
+	Page    int `json:"page"`
+	PerPage int `json:"perPage"`
+	Total   int `json:"total"`
+}
+
+// Dossier is the response of GET /dossiers/{number}
+type Dossier struct {
+	Dossier string           `json:"dossier"`
+	Number  uint             `json:"number"`
+	Year    uint             `json:"year"`
+	Order   *model.OrderFile `json:"order"`
+
+	// Dossiers with the same number and year in other categories, only listed when no category was asked for
+	OtherCategories []Dossier `json:"otherCategories,omitempty"`
+}
+
+// DossierNotFound is the 404 response of GET /dossiers/{number}
+type DossierNotFound struct {
+	Error      string            `json:"error"`
+	DidYouMean []Dossier         `json:"didYouMean"` // dossiers one typo away, closest first
+	Estimate   *dossier.Estimate `json:"estimate"`   // where the processing front stands
+	Summary    string            `json:"summary"`    // the estimate in words
+}
+
+// OrderFile is the response of GET /orders/{filename}
+type OrderFile struct {
+	model.OrderFile
+	Dossiers []model.Order      `json:"dossiers"`
+	History  []model.Transition `json:"history"` // state transitions, oldest first
+}
+
+// Stats is the response of GET /stats
+type Stats struct {
+	OrderFiles       int            `json:"orderFiles"`
+	BrokenURLs       int            `json:"brokenURLs"`
+	Downloaded       int            `json:"downloaded"`
+	Parsed           int            `json:"parsed"`
+	FirstOrderDate   string         `json:"firstOrderDate"`
+	LastOrderDate    string         `json:"lastOrderDate"`
+	Dossiers         int            `json:"dossiers"`
+	DossiersPerYear  map[uint]int   `json:"dossiersPerYear"`
+	OrderFilesSource map[string]int `json:"orderFilesPerSource"`
+	OrderFilesState  map[string]int `json:"orderFilesPerState"`
+}
+
+// ProcessingTimes is the response of GET /stats/processing-times
+type ProcessingTimes struct {
+	Unit  string               `json:"unit"` // unit of the distribution values, months
+	Items []stats.Distribution `json:"items"`
+}
+
+// Server serves read-only JSON lookups over the orders database
+type Server struct {
+	db       *sql.DB
+	blobDirs []string
+	mux      *http.ServeMux
+}
+
+// NewServer returns a read-only API server over db; blobDirs are the folders checked for writability by /healthz
+func NewServer(db *sql.DB, blobDirs ...string) *Server {
+	s := &Server{db: db, blobDirs: blobDirs, mux: http.NewServeMux()}
+
+	s.mux.HandleFunc("/dossiers/", s.dossier)
+	s.mux.HandleFunc("/orders", s.orders)
+	s.mux.HandleFunc("/orders/", s.orderFile)
+	s.mux.HandleFunc("/stats", s.stats)
+	s.mux.HandleFunc("/stats/processing-times", s.processingTimes)
+	s.mux.HandleFunc("/search", s.search)
+	s.mux.HandleFunc("/feeds/", s.feed)
+	s.mux.HandleFunc("/openapi.json", s.openAPI)
+	s.mux.HandleFunc("/healthz", s.healthz)
+	s.mux.HandleFunc("/readyz", s.readyz)
+	s.mux.HandleFunc("/status", s.status)
+
+	return s
+}
+
+// Handle registers an additional handler, used to mount other read-only endpoints on the same server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// ServeHTTP only allows GET and HEAD requests
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// dossier handles GET /dossiers/{number}; number is read by dossier.Parse, so "12345/2019", "12345-19",
+// "12345 RD 2019" or "dosar 12345/rd/2019" all work, the last two only matching RD dossiers. Without category
+// letters the first category found is answered, the others listed in otherCategories. A dossier which isn't
+// found is answered with 404, the close dossier numbers which are in parsed orders and the queue estimate of the
+// dossier.
+func (s *Server) dossier(w http.ResponseWriter, r *http.Request) {
+	raw := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dossiers/"), "/")
+	match, err := dossier.Lookup(r.Context(), s.db, raw)
+	if errors.Is(err, dossier.ErrInvalid) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	if len(match.Orders) == 0 {
+		resp := DossierNotFound{
+			Error:      fmt.Sprintf("dossier %s not found", match.Query),
+			DidYouMean: make([]Dossier, 0),
+			Estimate:   match.Estimate,
+			Summary:    match.Estimate.Summary(),
+		}
+		for _, candidate := range match.Candidates {
+			d, err := s.dossierWithOrder(r, candidate)
+			if err != nil {
+				s.internalError(w, r, err)
+				return
+			}
+			resp.DidYouMean = append(resp.DidYouMean, d)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	resp, err := s.dossierWithOrder(r, match.Orders[0])
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	for _, other := range match.Orders[1:] {
+		d, err := s.dossierWithOrder(r, other)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.OtherCategories = append(resp.OtherCategories, d)
+	}
+	writeJSON(w, r, resp)
+}
+
+// dossierWithOrder returns a dossier with its order file, which is nil if the file row is missing
+func (s *Server) dossierWithOrder(r *http.Request, order model.Order) (Dossier, error) {
+	resp := Dossier{Dossier: order.FullNameFormatted, Number: order.Number, Year: order.Year}
+	file, err := model.ScanOrderFile(s.db.QueryRowContext(r.Context(), model.Get_Order_File, order.Filename))
+	switch {
+	case err == nil:
+		resp.Order = &file
+	case !errors.Is(err, sql.ErrNoRows):
+		return resp, err
+	}
+	return resp, nil
+}
+
+// orders handles GET /orders?from=&to=&source=&page=&perPage=
+func (s *Server) orders(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, to := q.Get("from"), q.Get("to")
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid date %q, expected YYYY-MM-DD", d))
+			return
+		}
+	}
+	source := q.Get("source")
+
+	page, perPage, err := pagination(q.Get("page"), q.Get("perPage"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp := Page[model.OrderFile]{Items: make([]model.OrderFile, 0), Page: page, PerPage: perPage}
+	err = s.db.QueryRowContext(r.Context(), model.Count_Order_Files, from, to, source).Scan(&resp.Total)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), model.Get_Order_Files_page, from, to, source, perPage, (page-1)*perPage)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := model.ScanOrderFile(rows)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.Items = append(resp.Items, f)
+	}
+	if err := rows.Err(); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, resp)
+}
+
+// orderFile handles GET /orders/{filename}
+func (s *Server) orderFile(w http.ResponseWriter, r *http.Request) {
+	filename := strings.TrimPrefix(r.URL.Path, "/orders/")
+	if filename == "" || strings.Contains(filename, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	file, err := model.ScanOrderFile(s.db.QueryRowContext(r.Context(), model.Get_Order_File, filename))
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("order file %s not found", filename))
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	resp := OrderFile{OrderFile: file, Dossiers: make([]model.Order, 0)}
+	rows, err := s.db.QueryContext(r.Context(), model.Get_Orders_by_Filename, filename)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		o, err := model.ScanOrder(rows)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.Dossiers = append(resp.Dossiers, o)
+	}
+	if err := rows.Err(); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	rows.Close()
+
+	resp.History = make([]model.Transition, 0)
+	rows, err = s.db.QueryContext(r.Context(), model.Get_Transitions_by_Filename, filename)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := model.ScanTransition(rows)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.History = append(resp.History, t)
+	}
+	if err := rows.Err(); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	writeJSON(w, r, resp)
+}
+
+// stats handles GET /stats
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) {
+	resp := Stats{DossiersPerYear: make(map[uint]int), OrderFilesSource: make(map[string]int), OrderFilesState: make(map[string]int)}
+
+	err := s.db.QueryRowContext(r.Context(), model.Get_Order_Files_stats).
+		Scan(&resp.OrderFiles, &resp.BrokenURLs, &resp.Downloaded, &resp.Parsed, &resp.FirstOrderDate, &resp.LastOrderDate)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), model.Get_Orders_per_Year)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var year uint
+		var count int
+		if err := rows.Scan(&year, &count); err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.DossiersPerYear[year] = count
+		resp.Dossiers += count
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(r.Context(), model.Get_Order_Files_per_Source)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var source string
+		var count int
+		if err := rows.Scan(&source, &count); err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.OrderFilesSource[source] = count
+	}
+	rows.Close()
+
+	rows, err = s.db.QueryContext(r.Context(), model.Get_Order_Files_per_State)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var state string
+		var count int
+		if err := rows.Scan(&state, &count); err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		resp.OrderFilesState[state] = count
+	}
+
+	writeJSON(w, r, resp)
+}
+
+// search handles GET /search?q=&page=&perPage=; snippets are HTML with the matched terms in <mark> elements
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("q"))
+	if model.MatchQuery(text) == "" {
+		writeError(w, http.StatusBadRequest, "missing search text, expected q with letters or digits")
+		return
+	}
+
+	page, perPage, err := pagination(q.Get("page"), q.Get("perPage"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hits, total, err := model.Search(r.Context(), s.db, text, perPage, (page-1)*perPage)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// The page text is escaped before the markers become elements
+	mark := strings.NewReplacer(model.HighlightStart, "<mark>", model.HighlightEnd, "</mark>")
+	for i := range hits {
+		hits[i].Snippet = mark.Replace(html.EscapeString(hits[i].Snippet))
+	}
+
+	writeJSON(w, r, Page[model.SearchHit]{Items: hits, Page: page, PerPage: perPage, Total: total})
+}
+
+// processingTimes handles GET /stats/processing-times?windows=&source=&series=
+func (s *Server) processingTimes(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := stats.Options{Source: q.Get("source"), Series: q.Get("series")}
+	if raw := q.Get("windows"); raw != "" {
+		windows, err := stats.ParseWindows(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		opts.Windows = windows
+	}
+
+	distributions, err := stats.ProcessingTimes(r.Context(), s.db, opts)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeJSON(w, r, ProcessingTimes{Unit: "months", Items: distributions})
+}
+
+// openAPI serves the OpenAPI document of the API
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	writeBody(w, r, "application/json", openAPI)
+}
+
+// internalError logs err and answers with 500 without exposing the details
+func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("API request failed", "path", r.URL.Path, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// pagination parses page and perPage query values
+func pagination(pageRaw, perPageRaw string) (int, int, error) {
+	page, perPage := 1, defaultPerPage
+	if pageRaw != "" {
+		n, err := strconv.Atoi(pageRaw)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid page %q", pageRaw)
+		}
+		page = n
+	}
+	if perPageRaw != "" {
+		n, err := strconv.Atoi(perPageRaw)
+		if err != nil || n < 1 || n > maxPerPage {
+			return 0, 0, fmt.Errorf("invalid perPage %q, expected 1..%d", perPageRaw, maxPerPage)
+		}
+		perPage = n
+	}
+	return page, perPage, nil
+}
+
+// writeJSON encodes v and writes it with an ETag
+func writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("API response encoding failed", "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeBody(w, r, "application/json", body)
+}
+
+// writeBody writes body with a content-based ETag and answers 304 if the client already has it
+func writeBody(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header contains etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
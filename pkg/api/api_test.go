@@ -0,0 +1,262 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"romaniabot/model"
+
+	_ "modernc.org/sqlite"
+)
+
+// newTestServer returns a server over a migrated in-memory database holding order files
+// ordin-1.pdf to ordin-n.pdf, ordin-1.pdf being the latest order
+func newTestServer(t *testing.T, n int) *Server {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := model.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		filename := fmt.Sprintf("ordin-%d.pdf", i)
+		orderDate := fmt.Sprintf("2023-05-%02d", 28-i)
+		_, err := db.Exec(model.Insert_Order_File, orderDate, "https://example.com/"+filename, filename,
+			"Ordin "+orderDate, orderDate, 100+i, "P", "https://example.com/ordine/")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewServer(db)
+}
+
+// get sends a request to s and returns the recorded response
+func get(s *Server, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestETag(t *testing.T) {
+	s := newTestServer(t, 0)
+	etag := get(s, http.MethodGet, "/openapi.json", nil).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		status      int
+		body        bool
+	}{
+		{name: "no If-None-Match", method: http.MethodGet, status: http.StatusOK, body: true},
+		{name: "same ETag", method: http.MethodGet, ifNoneMatch: etag, status: http.StatusNotModified},
+		{name: "weak ETag", method: http.MethodGet, ifNoneMatch: "W/" + etag, status: http.StatusNotModified},
+		{name: "ETag in a list", method: http.MethodGet, ifNoneMatch: `"other", ` + etag, status: http.StatusNotModified},
+		{name: "any ETag", method: http.MethodGet, ifNoneMatch: "*", status: http.StatusNotModified},
+		{name: "other ETag", method: http.MethodGet, ifNoneMatch: `"other"`, status: http.StatusOK, body: true},
+		{name: "HEAD", method: http.MethodHead, status: http.StatusOK},
+		{name: "HEAD with same ETag", method: http.MethodHead, ifNoneMatch: etag, status: http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.ifNoneMatch != "" {
+				header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			w := get(s, tt.method, "/openapi.json", header)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %s, want %s", got, etag)
+			}
+			if got := w.Body.Len() > 0; got != tt.body {
+				t.Errorf("body sent = %v, want %v", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		page, perPage         string
+		wantPage, wantPerPage int
+		wantErr               bool
+	}{
+		{wantPage: 1, wantPerPage: defaultPerPage},
+		{page: "3", perPage: "20", wantPage: 3, wantPerPage: 20},
+		{perPage: "500", wantPage: 1, wantPerPage: maxPerPage},
+		{page: "0", wantErr: true},
+		{page: "-1", wantErr: true},
+		{page: "two", wantErr: true},
+		{perPage: "0", wantErr: true},
+		{perPage: "501", wantErr: true},
+	}
+	for _, tt := range tests {
+		page, perPage, err := pagination(tt.page, tt.perPage)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("pagination(%q, %q) = %d, %d, want an error", tt.page, tt.perPage, page, perPage)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("pagination(%q, %q): %v", tt.page, tt.perPage, err)
+			continue
+		}
+		if page != tt.wantPage || perPage != tt.wantPerPage {
+			t.Errorf("pagination(%q, %q) = %d, %d, want %d, %d", tt.page, tt.perPage, page, perPage, tt.wantPage, tt.wantPerPage)
+		}
+	}
+}
+
+func TestOrdersPages(t *testing.T) {
+	s := newTestServer(t, 5)
+
+	tests := []struct {
+		query  string
+		status int
+		files  []string
+	}{
+		{query: "", status: http.StatusOK, files: []string{"ordin-1.pdf", "ordin-2.pdf", "ordin-3.pdf", "ordin-4.pdf", "ordin-5.pdf"}},
+		{query: "?perPage=2", status: http.StatusOK, files: []string{"ordin-1.pdf", "ordin-2.pdf"}},
+		{query: "?page=2&perPage=2", status: http.StatusOK, files: []string{"ordin-3.pdf", "ordin-4.pdf"}},
+		{query: "?page=3&perPage=2", status: http.StatusOK, files: []string{"ordin-5.pdf"}},
+		{query: "?page=4&perPage=2", status: http.StatusOK, files: []string{}},
+		{query: "?page=2&perPage=2&to=2023-05-25", status: http.StatusOK, files: []string{"ordin-5.pdf"}},
+		{query: "?page=0", status: http.StatusBadRequest},
+		{query: "?perPage=1000", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := get(s, http.MethodGet, "/orders"+tt.query, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var page Page[model.OrderFile]
+			if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+				t.Fatal(err)
+			}
+			files := make([]string, 0)
+			for _, f := range page.Items {
+				files = append(files, f.Filename)
+			}
+			if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("files = %v, want %v", files, tt.files)
+			}
+		})
+	}
+
+	// The total counts all pages of the filtered order files
+	var page Page[model.OrderFile]
+	json.Unmarshal(get(s, http.MethodGet, "/orders?perPage=1&from=2023-05-24", nil).Body.Bytes(), &page)
+	if page.Total != 4 || page.Page != 1 || page.PerPage != 1 {
+		t.Errorf("page %d of %d per page, total %d, want page 1 of 1 per page, total 4", page.Page, page.PerPage, page.Total)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	s := newTestServer(t, 0)
+
+	w := get(s, http.MethodGet, "/openapi.json", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %s, want application/json", got)
+	}
+	if !bytes.Equal(w.Body.Bytes(), openAPI) {
+		t.Error("served document differs from openapi.json")
+	}
+
+	var doc struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", doc.OpenAPI)
+	}
+
+	// Every documented path is routed, unlike unknown paths; /report/ is mounted by serve and daemon
+	routed := func(target string) bool {
+		w := get(s, http.MethodGet, target, nil)
+		return w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+	}
+	if routed("/unknown") {
+		t.Error("unknown path is routed")
+	}
+	for path := range doc.Paths {
+		if path == "/report/" {
+			continue
+		}
+		target := strings.NewReplacer("{number}", "12345-2019", "{filename}", "ordin-1.pdf").Replace(path)
+		if !routed(target) {
+			t.Errorf("documented path %s isn't routed", path)
+		}
+	}
+}
+
+func TestDossierCategories(t *testing.T) {
+	s := newTestServer(t, 2)
+	for _, o := range []struct{ filename, name, category string }{
+		{filename: "ordin-1.pdf", name: "12345/RD/2019", category: "RD"},
+		{filename: "ordin-2.pdf", name: "12345/P/2019", category: "P"},
+	} {
+		if _, err := s.db.Exec(model.Insert_Order_if_new, o.filename, 12345, 2019, o.name, o.category); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		number string
+		want   []string // the answered dossier, then the other categories
+	}{
+		{number: "12345-2019", want: []string{"12345/P/2019", "12345/RD/2019"}},
+		{number: "12345%20din%202019", want: []string{"12345/P/2019", "12345/RD/2019"}},
+		{number: "12345-RD-2019", want: []string{"12345/RD/2019"}},
+	}
+	for _, tt := range tests {
+		w := get(s, http.MethodGet, "/dossiers/"+tt.number, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.number, w.Code, http.StatusOK, w.Body)
+		}
+		var resp Dossier
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		got := []string{resp.Dossier}
+		for _, other := range resp.OtherCategories {
+			if other.Order == nil {
+				t.Errorf("%s: %s has no order file", tt.number, other.Dossier)
+			}
+			got = append(got, other.Dossier)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: dossiers = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/feeds"
+)
+
+const feedItems = 100
+
+// withCount appends an extra destination to a row scan, used for columns following the OrderFiles column list
+type withCount struct {
+	row   model.Scanner
+	count *int
+}
+
+func (w withCount) Scan(dest ...any) error {
+	return w.row.Scan(append(dest, w.count)...)
+}
+
+// feed handles GET /feeds/atom.xml and GET /feeds/rss.xml, optionally filtered by dossier year with ?year=2019
+func (s *Server) feed(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimPrefix(r.URL.Path, "/feeds/")
+	if format != "atom.xml" && format != "rss.xml" {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	year := 0
+	if raw := r.URL.Query().Get("year"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 2000 || n > 2100 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid year %q", raw))
+			return
+		}
+		year = n
+	}
+
+	// Absolute URLs for the feed links
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	base := scheme + "://" + r.Host
+
+	f := feeds.Feed{
+		Title:   "Citizenship orders",
+		Link:    base + "/orders",
+		SelfURL: base + r.URL.RequestURI(),
+	}
+	if year != 0 {
+		f.Title = fmt.Sprintf("Citizenship orders with dossiers of %d", year)
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), model.Get_Feed_Order_Files, year, feedItems)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var dossiers int
+		file, err := model.ScanOrderFile(withCount{row: rows, count: &dossiers})
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		f.Items = append(f.Items, feedItem(file, dossiers))
+		if file.CreatedAt.After(f.Updated) {
+			f.Updated = file.CreatedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	if f.Updated.IsZero() {
+		f.Updated = time.Unix(0, 0)
+	}
+
+	var body []byte
+	var contentType string
+	if format == "atom.xml" {
+		body, err = feeds.Atom(f)
+		contentType = "application/atom+xml; charset=utf-8"
+	} else {
+		body, err = feeds.RSS(f)
+		contentType = "application/rss+xml; charset=utf-8"
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+
+	writeBody(w, r, contentType, body)
+}
+
+// feedItem converts an order file to a feed entry, published when the order file was first seen
+func feedItem(file model.OrderFile, dossiers int) feeds.Item {
+	summary := fmt.Sprintf("Order %s of %s, %d dossiers parsed. Source: %s", file.Name, file.Date, dossiers, file.Source)
+	if file.State != model.StateParsed {
+		summary = fmt.Sprintf("Order %s of %s, not parsed yet. Source: %s", file.Name, file.Date, file.Source)
+	}
+
+	return feeds.Item{
+		ID:        file.URL,
+		Title:     fmt.Sprintf("Order %s of %s", file.Name, file.Date),
+		Link:      file.URL,
+		Summary:   summary,
+		Category:  file.Source,
+		Published: file.CreatedAt,
+	}
+}
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+)
+
+// Check is the result of a single health check
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Health is the response of /healthz and /readyz
+type Health struct {
+	OK     bool    `json:"ok"`
+	Checks []Check `json:"checks"`
+}
+
+// Backlog is the number of order files waiting for a stage, counted with the query the stage uses
+type Backlog struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Status is the response of /status
+type Status struct {
+	SchemaVersion   int              `json:"schemaVersion"`
+	LastRunID       string           `json:"lastRunId"`
+	LastRunErrors   int              `json:"lastRunErrors"`
+	LastRunFinished bool             `json:"lastRunFinished"`
+	Stages          []model.StageRun `json:"stages"`
+	Backlogs        []Backlog        `json:"backlogs"`
+}
+
+// backlogs lists the stage queries counted on the status page
+var backlogs = []struct {
+	name  string
+	query string
+}{
+	{"Files not downloaded (Get_Files_not_downloaded)", model.Get_Files_not_downloaded},
+	{"URLs to verify (Get_URLs_to_verify)", model.Get_URLs_to_verify},
+	{"Files to download (Get_Files_to_download)", model.Get_Files_to_download},
+	{"Files to parse (Get_Files_to_parse)", model.Get_Files_to_parse},
+	{"Queued and running jobs", model.Get_Active_Jobs},
+	{"Dead-lettered jobs", model.Get_Dead_Jobs},
+	{"Pending webhook deliveries", model.Get_Pending_Webhook_Deliveries},
+}
+
+// healthz handles GET /healthz: the process is up, DB is reachable and blob folders are writable
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	health := Health{OK: true}
+	add := func(name string, err error) {
+		c := Check{Name: name, OK: err == nil}
+		if err != nil {
+			c.Error = err.Error()
+			health.OK = false
+		}
+		health.Checks = append(health.Checks, c)
+	}
+
+	add("db", s.db.PingContext(ctx))
+	for _, dir := range s.blobDirs {
+		add("writable:"+dir, writable(dir))
+	}
+
+	writeHealth(w, health)
+}
+
+// readyz handles GET /readyz: all schema migrations are applied
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	health := Health{OK: true}
+
+	version, err := model.SchemaVersion(s.db)
+	c := Check{Name: "schema", OK: err == nil && version == len(model.Migrations)}
+	switch {
+	case err != nil:
+		c.Error = err.Error()
+	case !c.OK:
+		c.Error = fmt.Sprintf("schema version %d, expected %d", version, len(model.Migrations))
+	}
+	health.OK = c.OK
+	health.Checks = append(health.Checks, c)
+
+	writeHealth(w, health)
+}
+
+// status handles GET /status, as HTML or as JSON with ?format=json or Accept: application/json
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	st := Status{Stages: make([]model.StageRun, 0)}
+
+	version, err := model.SchemaVersion(s.db)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	st.SchemaVersion = version
+
+	// Latest run of every stage
+	rows, err := s.db.QueryContext(ctx, model.Get_Last_Stage_Runs)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		run, err := model.ScanStageRun(rows)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		st.Stages = append(st.Stages, run)
+	}
+	rows.Close()
+
+	// Errors of the latest run, whatever stages it included
+	rows, err = s.db.QueryContext(ctx, model.Get_Last_Run_Stages)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	defer rows.Close()
+	st.LastRunFinished = true
+	for rows.Next() {
+		run, err := model.ScanStageRun(rows)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		st.LastRunID = run.RunID
+		st.LastRunErrors += run.Errors
+		if run.FinishedAt == nil {
+			st.LastRunFinished = false
+		}
+	}
+	rows.Close()
+
+	for _, b := range backlogs {
+		var count int
+		err := s.db.QueryRowContext(ctx, countQuery(b.query)).Scan(&count)
+		if err != nil {
+			s.internalError(w, r, err)
+			return
+		}
+		st.Backlogs = append(st.Backlogs, Backlog{Name: b.name, Count: count})
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		writeJSON(w, r, st)
+		return
+	}
+
+	var sb strings.Builder
+	if err := statusPage.Execute(&sb, st); err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	writeBody(w, r, "text/html; charset=utf-8", []byte(sb.String()))
+}
+
+// countQuery wraps a stage query to count its rows
+func countQuery(query string) string {
+	return "SELECT COUNT(*) FROM (" + strings.TrimSuffix(strings.TrimSpace(query), ";") + ")"
+}
+
+// writable checks that dir exists and a file can be created in it; serve and daemon create the folders at startup,
+// a probe doesn't create them itself
+func writable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a folder", dir)
+	}
+	f, err := os.CreateTemp(dir, ".healthz-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// writeHealth writes a health response, 503 if any check failed
+func writeHealth(w http.ResponseWriter, health Health) {
+	status := http.StatusOK
+	if !health.OK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
+
+var statusPage = template.Must(template.New("status").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"finished": func(t *time.Time) string {
+		if t == nil {
+			return "—"
+		}
+		return t.UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>romaniabot status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>romaniabot status</h1>
+<p>Schema version {{.SchemaVersion}}.
+{{if .LastRunID}}Last run {{.LastRunID}}
+{{if not .LastRunFinished}}is running or was interrupted{{else if .LastRunErrors}}<span class="error">finished with {{.LastRunErrors}} errors</span>{{else}}finished without errors{{end}}.
+{{else}}No runs recorded yet.{{end}}</p>
+<h2>Stages</h2>
+<table>
+<tr><th>Stage</th><th>Run</th><th>Started</th><th>Finished</th><th>Errors</th><th>Last error</th></tr>
+{{range .Stages}}<tr><td>{{.Stage}}</td><td>{{.RunID}}</td><td>{{time .StartedAt}}</td><td>{{finished .FinishedAt}}</td><td{{if .Errors}} class="error"{{end}}>{{.Errors}}</td><td>{{.LastError}}</td></tr>
+{{end}}</table>
+<h2>Backlogs</h2>
+<table>
+<tr><th>Queue</th><th>Files</th></tr>
+{{range .Backlogs}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,343 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"romaniabot/pkg/web"
+)
+
+// EnvPrefix is the prefix of environment variables overriding the config file.
+// The variable name is built from the YAML path: storage.ordersPath -> ROMANIABOT_STORAGE_ORDERSPATH.
+const EnvPrefix = "ROMANIABOT"
+
+// Config is the whole bot configuration
+type Config struct {
+	Sources    []string   `yaml:"sources"` // listing pages to scrape
+	Storage    Storage    `yaml:"storage"`
+	HTTP       HTTP       `yaml:"http"`
+	Server     Server     `yaml:"server"`
+	Bot        Bot        `yaml:"bot"`
+	Politeness Politeness `yaml:"politeness"`
+	Scheduler  Scheduler  `yaml:"scheduler"`
+	Queue      Queue      `yaml:"queue"`
+	Log        Log        `yaml:"log"`
+}
+
+// Storage configures where data is kept
+type Storage struct {
+	DBPath        string `yaml:"dbPath"`
+	OrdersPath    string `yaml:"ordersPath"`
+	SnapshotsPath string `yaml:"snapshotsPath"`
+	ReportsPath   string `yaml:"reportsPath"` // HTML report written by the report command and hosted under /report/
+}
+
+// HTTP configures outbound requests
+type HTTP struct {
+	UserAgent          string        `yaml:"userAgent"`
+	Timeout            time.Duration `yaml:"timeout"`
+	PingTimeout        time.Duration `yaml:"pingTimeout"`
+	PingRetries        int           `yaml:"pingRetries"`
+	AllowedContentType string        `yaml:"allowedContentType"`
+	Proxy              string        `yaml:"proxy"`           // http, https or socks5 proxy URL
+	CABundle           string        `yaml:"caBundle"`        // PEM file with extra trusted certificates
+	MaxConnsPerHost    int           `yaml:"maxConnsPerHost"` // 0 for no limit
+	Gzip               bool          `yaml:"gzip"`
+}
+
+// Politeness configures crawling of the scraped sites
+type Politeness struct {
+	RespectRobots bool          `yaml:"respectRobots"` // honour robots.txt Disallow and Crawl-delay
+	MinDelay      time.Duration `yaml:"minDelay"`      // delay between requests to one host without Crawl-delay
+	QuietHours    string        `yaml:"quietHours"`    // HH:MM-HH:MM when crawling pauses, empty for none
+	TimeZone      string        `yaml:"timeZone"`      // IANA time zone of quietHours
+}
+
+// Location returns the time zone of the quiet hours
+func (p Politeness) Location() (*time.Location, error) {
+	return time.LoadLocation(p.TimeZone)
+}
+
+// Server configures the HTTP API
+type Server struct {
+	Addr string `yaml:"addr"`
+}
+
+// Bot configures the Telegram bot
+type Bot struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string `yaml:"token"`
+}
+
+// Scheduler configures the daemon mode
+type Scheduler struct {
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Queue configures the download and parse job queue
+type Queue struct {
+	VisibilityTimeout time.Duration `yaml:"visibilityTimeout"` // lease of a claimed job, renewed while the worker is alive
+	MaxAttempts       int           `yaml:"maxAttempts"`       // attempts before a job is dead-lettered
+	Backoff           time.Duration `yaml:"backoff"`           // delay after the first failed attempt, doubled after each next one up to a day
+	PollInterval      time.Duration `yaml:"pollInterval"`      // how often the worker command looks for new jobs
+}
+
+// Log configures the log output on stderr
+type Log struct {
+	Format string `yaml:"format"` // text or json
+	Level  string `yaml:"level"`  // debug, info, warn or error
+}
+
+// Default returns the configuration used when no file and no environment overrides are given
+func Default() Config {
+	return Config{
+		Sources: []string{"https://cetatenie.just.ro/ordine-articolul-1-1/"},
+		Storage: Storage{
+			DBPath:        "./orders.db",
+			OrdersPath:    "orders/",
+			SnapshotsPath: "snapshots/",
+			ReportsPath:   "reports/",
+		},
+		HTTP: HTTP{
+			UserAgent:          "RomanianBot/1.0",
+			Timeout:            60 * time.Second,
+			PingTimeout:        20 * time.Second,
+			PingRetries:        2,
+			AllowedContentType: "application/pdf",
+			MaxConnsPerHost:    8,
+			Gzip:               true,
+		},
+		Politeness: Politeness{
+			RespectRobots: true,
+			MinDelay:      time.Second,
+			TimeZone:      "Europe/Bucharest",
+		},
+		Server:    Server{Addr: ":8080"},
+		Scheduler: Scheduler{Interval: 6 * time.Hour},
+		Queue: Queue{
+			VisibilityTimeout: 5 * time.Minute,
+			MaxAttempts:       5,
+			Backoff:           time.Minute,
+			PollInterval:      30 * time.Second,
+		},
+		Log: Log{Format: "text", Level: "info"},
+	}
+}
+
+// Load reads the config file at path over the defaults, applies environment overrides and validates the result.
+// An empty path skips the file.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error reading config %s: %w", path, err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// an empty file decodes to io.EOF and leaves the defaults
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("error parsing config %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem(), EnvPrefix); err != nil {
+		return cfg, err
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the configuration and returns all problems at once
+func (c Config) Validate() error {
+	var errs []error
+
+	if len(c.Sources) == 0 {
+		errs = append(errs, errors.New("sources: at least one listing page is required"))
+	}
+	for _, s := range c.Sources {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("sources: %q is not an http(s) URL", s))
+		}
+	}
+
+	if c.Storage.DBPath == "" {
+		errs = append(errs, errors.New("storage.dbPath is required"))
+	}
+	if c.Storage.OrdersPath == "" {
+		errs = append(errs, errors.New("storage.ordersPath is required"))
+	}
+	if c.Storage.SnapshotsPath == "" {
+		errs = append(errs, errors.New("storage.snapshotsPath is required"))
+	}
+	if c.Storage.ReportsPath == "" {
+		errs = append(errs, errors.New("storage.reportsPath is required"))
+	}
+
+	if c.HTTP.UserAgent == "" {
+		errs = append(errs, errors.New("http.userAgent is required"))
+	}
+	if c.HTTP.Timeout <= 0 {
+		errs = append(errs, errors.New("http.timeout must be positive"))
+	}
+	if c.HTTP.PingTimeout <= 0 {
+		errs = append(errs, errors.New("http.pingTimeout must be positive"))
+	}
+	if c.HTTP.PingRetries < 1 {
+		errs = append(errs, errors.New("http.pingRetries must be at least 1"))
+	}
+	if c.HTTP.Proxy != "" {
+		// The proxy URL may carry credentials, only its redacted form is printed
+		u, err := url.Parse(c.HTTP.Proxy)
+		switch {
+		case err != nil:
+			errs = append(errs, errors.New("http.proxy is not a proxy URL"))
+		case u.Host == "":
+			errs = append(errs, fmt.Errorf("http.proxy: %q is not a proxy URL", u.Redacted()))
+		}
+	}
+	if c.HTTP.MaxConnsPerHost < 0 {
+		errs = append(errs, errors.New("http.maxConnsPerHost can't be negative"))
+	}
+
+	if c.Politeness.MinDelay < 0 {
+		errs = append(errs, errors.New("politeness.minDelay can't be negative"))
+	}
+	if loc, err := c.Politeness.Location(); err != nil {
+		errs = append(errs, fmt.Errorf("politeness.timeZone: %w", err))
+	} else if _, err := web.ParseQuietHours(c.Politeness.QuietHours, loc); err != nil {
+		errs = append(errs, fmt.Errorf("politeness.quietHours: %w", err))
+	}
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Bot.Enabled && c.Bot.Token == "" {
+		errs = append(errs, errors.New("bot.token is required when the bot is enabled"))
+	}
+	if c.Scheduler.Interval < time.Minute {
+		errs = append(errs, errors.New("scheduler.interval must be at least 1m"))
+	}
+
+	if c.Queue.VisibilityTimeout < 10*time.Second {
+		errs = append(errs, errors.New("queue.visibilityTimeout must be at least 10s"))
+	}
+	if c.Queue.MaxAttempts < 1 {
+		errs = append(errs, errors.New("queue.maxAttempts must be at least 1"))
+	}
+	if c.Queue.Backoff < 0 {
+		errs = append(errs, errors.New("queue.backoff can't be negative"))
+	}
+	if c.Queue.PollInterval < time.Second {
+		errs = append(errs, errors.New("queue.pollInterval must be at least 1s"))
+	}
+
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("log.format: %q is not text or json", c.Log.Format))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// String returns the configuration as YAML with secrets masked
+func (c Config) String() string {
+	if c.Bot.Token != "" {
+		c.Bot.Token = "********"
+	}
+	if u, err := url.Parse(c.HTTP.Proxy); err == nil {
+		c.HTTP.Proxy = u.Redacted()
+	} else if c.HTTP.Proxy != "" {
+		c.HTTP.Proxy = "********"
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("error encoding config: %v", err)
+	}
+	return string(data)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyEnv sets struct fields from environment variables named after their YAML path
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			return fmt.Errorf("error in %s=%q: %w", name, raw, err)
+		}
+	}
+	return nil
+}
+
+// setValue parses raw into a field of a supported kind; slices are comma separated
+func setValue(fv reflect.Value, raw string) error {
+	switch {
+	case fv.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+	case fv.Kind() == reflect.String:
+		fv.SetString(raw)
+	case fv.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(n))
+	case fv.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String:
+		items := make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		fv.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+// Package dossier reads dossier numbers the way users type them and finds them among the parsed orders,
+// suggesting close dossier numbers when there is no exact match.
+package dossier
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"romaniabot/model"
+)
+
+// Years accepted in a dossier number, the same range the PDF parser accepts
+const (
+	MinYear = 2010
+	MaxYear = 2050
+)
+
+// MaxCandidates is the number of "did you mean" dossiers returned by Lookup
+const MaxCandidates = 5
+
+// ErrInvalid is returned by Parse for text which holds no dossier number
+var ErrInvalid = errors.New("invalid dossier number")
+
+// Number is a parsed dossier number such as 12345/RD/2019
+type Number struct {
+	Number uint
+	Series string // category letters between number and year, upper case, e.g. "RD"; empty if not given
+	Year   uint
+}
+
+// String returns the number the way orders print it, e.g. "12345/RD/2019", or "12345/2019" without a series
+func (n Number) String() string {
+	if n.Series == "" {
+		return numberYear(n.Number, n.Year)
+	}
+	return strconv.Itoa(int(n.Number)) + "/" + n.Series + "/" + strconv.Itoa(int(n.Year))
+}
+
+// numberYear returns a dossier number without its category, e.g. "12345/2019", as compared by Lookup
+func numberYear(number, year uint) string {
+	return strconv.Itoa(int(number)) + "/" + strconv.Itoa(int(year))
+}
+
+// homoglyphs maps Cyrillic and Greek letters which look like Latin letters or digits, as pasted from other documents
+var homoglyphs = map[rune]rune{
+	'З': '3', 'з': '3',
+	'А': 'a', 'В': 'b', 'Д': 'd', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c', 'Т': 't',
+	'У': 'y', 'Х': 'x', 'І': 'i', 'Ј': 'j', 'Ѕ': 's', 'Ԁ': 'd',
+	'а': 'a', 'д': 'd', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'ԁ': 'd',
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'i', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n', 'Ο': 'o', 'Ρ': 'p',
+	'Τ': 't', 'Υ': 'y', 'Χ': 'x', 'ο': 'o', 'ρ': 'p',
+}
+
+// connectors are words users type between the number and the year, e.g. "12345 din 2019", which aren't a series
+var connectors = map[string]bool{"din": true, "nr": true, "an": true, "anul": true, "dosar": true, "dosarul": true, "of": true}
+
+// digitLookalikes maps letters typed instead of digits, see Normalize
+var digitLookalikes = map[rune]rune{'o': '0', 'l': '1', 'i': '1'}
+
+// Normalize folds text to lower case ASCII letters and digits, everything else becoming a space.
+// Homoglyphs and full-width forms are replaced by their ASCII letters and digits, and a single o, l or i
+// next to a digit is read as 0 or 1, so "123О5/2О19" (with Cyrillic О) becomes "12305 2019".
+func Normalize(text string) string {
+	runes := make([]rune, 0, len(text))
+	for _, r := range text {
+		// Full-width forms, e.g. "１２３４５／２０１９"
+		if r >= '！' && r <= '～' {
+			r -= '！' - '!'
+		}
+		if g, ok := homoglyphs[r]; ok {
+			r = g
+		}
+		r = unicode.ToLower(r)
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			r = ' '
+		}
+		runes = append(runes, r)
+	}
+
+	isDigit := func(i int) bool { return i >= 0 && i < len(runes) && runes[i] >= '0' && runes[i] <= '9' }
+	isLetter := func(i int) bool { return i >= 0 && i < len(runes) && runes[i] >= 'a' && runes[i] <= 'z' }
+	for i, r := range runes {
+		d, ok := digitLookalikes[r]
+		if ok && !isLetter(i-1) && !isLetter(i+1) && (isDigit(i-1) || isDigit(i+1)) {
+			runes[i] = d
+		}
+	}
+	return strings.Join(strings.Fields(string(runes)), " ")
+}
+
+// Parse reads a dossier number typed by a user: "12345/2019", "12345 RD 2019", "12345/rd/19", "dosar nr. 12345-2019".
+// Separators and case don't matter, two-digit years are in the 2000s, and words before the number, like "dosar" or
+// "nr", are skipped, as are words after the year and connectors like "din" in "12345 din 2019".
+// Returns ErrInvalid if the text holds no dossier number.
+func Parse(text string) (Number, error) {
+	tokens := tokenize(Normalize(text))
+
+	// Words before the number
+	i := 0
+	for i < len(tokens) && !isDigits(tokens[i]) {
+		i++
+	}
+	if i == len(tokens) {
+		return Number{}, fmt.Errorf("%w %q: no number", ErrInvalid, text)
+	}
+	number, err := strconv.ParseUint(tokens[i], 10, 32)
+	if err != nil || number == 0 {
+		return Number{}, fmt.Errorf("%w %q: bad number %s", ErrInvalid, text, tokens[i])
+	}
+	i++
+
+	// Category letters between number and year
+	var series []string
+	for i < len(tokens) && !isDigits(tokens[i]) {
+		if !connectors[tokens[i]] {
+			series = append(series, tokens[i])
+		}
+		i++
+	}
+	if i == len(tokens) {
+		return Number{}, fmt.Errorf("%w %q: no year", ErrInvalid, text)
+	}
+	year, err := parseYear(tokens[i])
+	if err != nil {
+		return Number{}, fmt.Errorf("%w %q: %v", ErrInvalid, text, err)
+	}
+	i++
+
+	// Only words may follow the year, another number makes the text ambiguous
+	for ; i < len(tokens); i++ {
+		if isDigits(tokens[i]) {
+			return Number{}, fmt.Errorf("%w %q: unexpected number %s after the year", ErrInvalid, text, tokens[i])
+		}
+	}
+
+	return Number{Number: uint(number), Series: strings.ToUpper(strings.Join(series, "")), Year: year}, nil
+}
+
+// Match is the result of a Lookup
+type Match struct {
+	Query      Number        // the parsed dossier number
+	Orders     []model.Order // the dossiers, one per category with the same number and year; empty if not found
+	Candidates []model.Order // close dossier numbers when Orders is empty, closest first
+	Estimate   *Estimate     // where the processing front stands when Orders is empty, see EstimateQueue
+}
+
+// Lookup parses text with Parse and finds the dossier among the parsed orders; a series given in text only matches
+// dossiers of that category, without one every category with that number and year matches. Without an exact match, up to MaxCandidates dossiers whose number/year is one typo away
+// are returned instead: one digit changed, missing or added, two adjacent digits swapped, or another year; along
+// with the queue estimate of the dossier.
+func Lookup(ctx context.Context, db *sql.DB, text string) (Match, error) {
+	query, err := Parse(text)
+	if err != nil {
+		return Match{}, err
+	}
+	match := Match{Query: query}
+
+	match.Orders, err = queryOrders(ctx, db, model.Get_Orders_by_Dossier, query.Year, query.Number, query.Series)
+	if err != nil {
+		return match, fmt.Errorf("error reading dossier %s: %w", query, err)
+	}
+	if len(match.Orders) > 0 {
+		match.Candidates = make([]model.Order, 0)
+		return match, nil
+	}
+
+	names, err := json.Marshal(variants(query))
+	if err != nil {
+		return match, err
+	}
+	match.Candidates, err = queryOrders(ctx, db, model.Get_Orders_by_Dossiers, string(names), query.Series)
+	if err != nil {
+		return match, fmt.Errorf("error reading similar dossiers: %w", err)
+	}
+
+	// Closest first: fewer edits, then the nearest year
+	want := numberYear(query.Number, query.Year)
+	sort.SliceStable(match.Candidates, func(i, j int) bool {
+		a, b := match.Candidates[i], match.Candidates[j]
+		distA, distB := distance(want, numberYear(a.Number, a.Year)), distance(want, numberYear(b.Number, b.Year))
+		if distA != distB {
+			return distA < distB
+		}
+		return absDiff(a.Year, query.Year) < absDiff(b.Year, query.Year)
+	})
+	if len(match.Candidates) > MaxCandidates {
+		match.Candidates = match.Candidates[:MaxCandidates]
+	}
+
+	estimate, err := EstimateQueue(ctx, db, query)
+	if err != nil {
+		return match, err
+	}
+	match.Estimate = &estimate
+	return match, nil
+}
+
+// queryOrders returns the dossiers selected by query, never nil
+func queryOrders(ctx context.Context, db *sql.DB, query string, args ...any) ([]model.Order, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	orders := make([]model.Order, 0)
+	for rows.Next() {
+		o, err := model.ScanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning dossier: %w", err)
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+// variants returns the "number/year" names one typo away from n: the number with one digit changed, deleted, inserted
+// or swapped with its neighbour in the same year, and the same number in every other year
+func variants(n Number) []string {
+	digits := strconv.Itoa(int(n.Number))
+	numbers := make(map[string]bool)
+	for i := 0; i <= len(digits); i++ {
+		for d := '0'; d <= '9'; d++ {
+			numbers[digits[:i]+string(d)+digits[i:]] = true
+			if i < len(digits) {
+				numbers[digits[:i]+string(d)+digits[i+1:]] = true
+			}
+		}
+		if i < len(digits) {
+			numbers[digits[:i]+digits[i+1:]] = true
+		}
+		if i+1 < len(digits) {
+			numbers[digits[:i]+digits[i+1:i+2]+digits[i:i+1]+digits[i+2:]] = true
+		}
+	}
+
+	names := make([]string, 0, len(numbers)+MaxYear-MinYear)
+	year := strconv.Itoa(int(n.Year))
+	for number := range numbers {
+		// Stored numbers have no leading zeros
+		if number == "" || number == digits || number[0] == '0' {
+			continue
+		}
+		names = append(names, number+"/"+year)
+	}
+	for y := uint(MinYear); y <= MaxYear; y++ {
+		if y != n.Year {
+			names = append(names, digits+"/"+strconv.Itoa(int(y)))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tokenize splits normalized text into runs of digits and runs of letters, so "12345rd2019" is 12345, rd, 2019
+func tokenize(s string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(s) {
+		start := 0
+		for i := 1; i <= len(field); i++ {
+			if i == len(field) || isDigit(field[i]) != isDigit(field[i-1]) {
+				tokens = append(tokens, field[start:i])
+				start = i
+			}
+		}
+	}
+	return tokens
+}
+
+// parseYear reads a four-digit year or a two-digit year of the 2000s
+func parseYear(s string) (uint, error) {
+	if len(s) != 2 && len(s) != 4 {
+		return 0, fmt.Errorf("bad year %s, expected 2 or 4 digits", s)
+	}
+	year, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad year %s", s)
+	}
+	if len(s) == 2 {
+		year += 2000
+	}
+	if year < MinYear || year > MaxYear {
+		return 0, fmt.Errorf("year %d out of range %d..%d", year, MinYear, MaxYear)
+	}
+	return uint(year), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isDigits(s string) bool { return s != "" && isDigit(s[0]) }
+
+func absDiff(a, b uint) uint {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// distance is the number of single-character edits, adjacent swaps included, between a and b
+func distance(a, b string) int {
+	// Optimal string alignment over three rows of the edit matrix
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
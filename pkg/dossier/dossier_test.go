@@ -0,0 +1,189 @@
+package dossier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"romaniabot/model"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"12345/RD/2019", "12345 rd 2019"},
+		{"  dosar nr. 12345-2019 ", "dosar nr 12345 2019"},
+		{"１２３４５／２０１９", "12345 2019"},
+		{"123О5/2О19", "12305 2019"}, // Cyrillic О
+		{"12З45/2019", "12345 2019"}, // Cyrillic З
+		{"1234l/2019", "12341 2019"},
+		{"rol 12345", "rol 12345"}, // o and l inside a word stay letters
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.text); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Number
+		wantErr bool
+	}{
+		{text: "12345/2019", want: Number{Number: 12345, Year: 2019}},
+		{text: "12345/RD/2019", want: Number{Number: 12345, Series: "RD", Year: 2019}},
+		{text: "12345 rd 19", want: Number{Number: 12345, Series: "RD", Year: 2019}},
+		{text: "dosar nr. 12345-2019", want: Number{Number: 12345, Year: 2019}},
+		{text: "12345rd2019", want: Number{Number: 12345, Series: "RD", Year: 2019}},
+		{text: "12345/2019 ordin", want: Number{Number: 12345, Year: 2019}},
+		{text: "12345 din 2019", want: Number{Number: 12345, Year: 2019}},
+		{text: "dosarul 12345 din anul 2019", want: Number{Number: 12345, Year: 2019}},
+		{text: "12345/RD din 2019", want: Number{Number: 12345, Series: "RD", Year: 2019}},
+		{text: "dosar", wantErr: true},
+		{text: "12345", wantErr: true},
+		{text: "0/2019", wantErr: true},
+		{text: "12345/1999", wantErr: true},
+		{text: "12345/2019/2020", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%q) = %+v, %v, want ErrInvalid", tt.text, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestNumberString(t *testing.T) {
+	tests := []struct {
+		n    Number
+		want string
+	}{
+		{Number{Number: 12345, Year: 2019}, "12345/2019"},
+		{Number{Number: 12345, Series: "RD", Year: 2019}, "12345/RD/2019"},
+	}
+	for _, tt := range tests {
+		if got := tt.n.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       Number
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "digit changed, deleted, inserted and swapped",
+			n:       Number{Number: 123, Year: 2019},
+			want:    []string{"124/2019", "13/2019", "1234/2019", "213/2019", "132/2019", "123/2018", "123/2020"},
+			notWant: []string{"123/2019", "321/2019", "124/2018"},
+		},
+		{
+			name:    "no leading zeros",
+			n:       Number{Number: 10, Year: 2019},
+			want:    []string{"1/2019", "100/2019"},
+			notWant: []string{"0/2019", "01/2019"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := variants(tt.n)
+			if !slices.IsSorted(got) {
+				t.Errorf("variants aren't sorted")
+			}
+			for _, name := range tt.want {
+				if !slices.Contains(got, name) {
+					t.Errorf("variants(%v) don't contain %s", tt.n, name)
+				}
+			}
+			for _, name := range tt.notWant {
+				if slices.Contains(got, name) {
+					t.Errorf("variants(%v) contain %s", tt.n, name)
+				}
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := model.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range []struct {
+		filename string
+		number   uint
+		year     uint
+		category string
+	}{
+		{filename: "ordin-rd.pdf", number: 12345, year: 2019, category: "RD"},
+		{filename: "ordin-p.pdf", number: 12345, year: 2019, category: "P"},
+		{filename: "ordin-p.pdf", number: 12346, year: 2019, category: "P"},
+	} {
+		name := Number{Number: o.number, Series: o.category, Year: o.year}.String()
+		if _, err := db.Exec(model.Insert_Order_if_new, o.filename, o.number, o.year, name, o.category); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		text       string
+		orders     []string
+		candidates []string
+	}{
+		{text: "12345/2019", orders: []string{"12345/P/2019", "12345/RD/2019"}},
+		{text: "12345 din 2019", orders: []string{"12345/P/2019", "12345/RD/2019"}},
+		{text: "12345/rd/2019", orders: []string{"12345/RD/2019"}},
+		{text: "12346/2019", orders: []string{"12346/P/2019"}},
+		{text: "12346/RD/2019", candidates: []string{"12345/RD/2019"}},
+		{text: "12347/2019", candidates: []string{"12345/P/2019", "12345/RD/2019", "12346/P/2019"}},
+	}
+	for _, tt := range tests {
+		match, err := Lookup(ctx, db, tt.text)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", tt.text, err)
+		}
+		names := func(orders []model.Order) []string {
+			result := make([]string, 0)
+			for _, o := range orders {
+				result = append(result, o.FullNameFormatted)
+			}
+			slices.Sort(result)
+			return result
+		}
+		if got := names(match.Orders); !slices.Equal(got, tt.orders) {
+			t.Errorf("Lookup(%q) orders = %q, want %q", tt.text, got, tt.orders)
+		}
+		if got := names(match.Candidates); !slices.Equal(got, tt.candidates) {
+			t.Errorf("Lookup(%q) candidates = %q, want %q", tt.text, got, tt.candidates)
+		}
+		if (match.Estimate == nil) != (len(tt.orders) > 0) {
+			t.Errorf("Lookup(%q) estimate = %v, want one only when not found", tt.text, match.Estimate)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package dossier
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+)
+
+// Estimator settings
+const (
+	// FrontWindow is how many days of orders make up the processing front
+	FrontWindow = 90
+	// RateWindow is how far back the front is compared with to measure its pace, in days
+	RateWindow = 180
+	// HistoryMonths is the number of months of front history returned with an estimate
+	HistoryMonths = 12
+)
+
+// Caveat qualifies every estimate
+const Caveat = "This is a rough projection from past orders, not an official estimate: dossiers are not resolved " +
+	"strictly in number order, the pace changes over time, and some orders are published late or aren't parsed."
+
+// FrontPoint is the processing front of a dossier year in the orders of one month
+type FrontPoint struct {
+	Month    string `json:"month"`    // e.g. "2026-09"
+	Highest  uint   `json:"highest"`  // highest dossier number resolved
+	Median   uint   `json:"median"`   // median dossier number resolved
+	Dossiers int    `json:"dossiers"` // dossiers of the year resolved
+}
+
+// Estimate is where the processing front of a dossier's year stands and when the dossier may be resolved
+type Estimate struct {
+	Dossier  string    `json:"dossier"` // e.g. "52310/2019"
+	Number   uint      `json:"number"`
+	Year     uint      `json:"year"`
+	Category string    `json:"category"` // category the front is measured on, "" for all categories
+	AsOf     time.Time `json:"asOf"`     // date of the latest order in the database, the end of the front window
+	// Front over the FrontWindow days up to AsOf
+	Highest  uint `json:"highest"`  // highest number of the year resolved, 0 if none was
+	Median   uint `json:"median"`   // median number of the year resolved
+	Resolved int  `json:"resolved"` // dossiers of the year resolved
+	Ahead    int  `json:"ahead"`    // dossier number minus Highest; zero or less if the front passed it
+	// Pace of the front over the RateWindow days up to AsOf, 0 if it can't be measured
+	NumbersPerMonth float64 `json:"numbersPerMonth"`
+	// Expected order date range, nil if it can't be projected
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+	// Monthly front of the year, oldest first
+	History []FrontPoint `json:"history"`
+	Caveat  string       `json:"caveat"`
+}
+
+// resolved is a dossier number with the date of its order
+type resolved struct {
+	date   time.Time
+	number uint
+}
+
+// EstimateQueue tells where the processing front of n's year stands relative to n and projects a rough date range
+// for its order. The front is measured on n's category if orders of that category were parsed, else on all
+// categories of the year.
+func EstimateQueue(ctx context.Context, db *sql.DB, n Number) (Estimate, error) {
+	e := Estimate{Dossier: n.String(), Number: n.Number, Year: n.Year, History: make([]FrontPoint, 0), Caveat: Caveat}
+
+	var last string
+	if err := db.QueryRowContext(ctx, model.Get_Last_Order_Date).Scan(&last); err != nil {
+		return e, fmt.Errorf("error reading last order date: %w", err)
+	}
+	asOf, err := time.Parse("2006-01-02", last)
+	if err != nil {
+		// No dated orders yet
+		return e, nil
+	}
+	e.AsOf = asOf
+
+	dossiers, err := resolvedDossiers(ctx, db, n.Year, n.Series)
+	if err != nil {
+		return e, err
+	}
+	if n.Series != "" && len(dossiers) > 0 {
+		e.Category = n.Series
+	}
+	if len(dossiers) == 0 && n.Series != "" {
+		if dossiers, err = resolvedDossiers(ctx, db, n.Year, ""); err != nil {
+			return e, err
+		}
+	}
+
+	// Current front and the front RateWindow days earlier
+	numbers := numbersBetween(dossiers, asOf.AddDate(0, 0, -FrontWindow), asOf)
+	e.Resolved = len(numbers)
+	if len(numbers) > 0 {
+		e.Highest, e.Median = numbers[len(numbers)-1], numbers[len(numbers)/2]
+	}
+	e.Ahead = int(n.Number) - int(e.Highest)
+
+	then := asOf.AddDate(0, 0, -RateWindow)
+	earlier := numbersBetween(dossiers, then.AddDate(0, 0, -FrontWindow), then)
+	if len(numbers) > 0 && len(earlier) > 0 && e.Highest > earlier[len(earlier)-1] {
+		e.NumbersPerMonth = float64(e.Highest-earlier[len(earlier)-1]) / (RateWindow / 30.0)
+	}
+
+	// Projection: the front reaching the number at between half and one and a half times the measured pace
+	if e.Ahead > 0 && e.NumbersPerMonth > 0 {
+		months := float64(e.Ahead) / e.NumbersPerMonth
+		from := asOf.AddDate(0, 0, int(months/1.5*30))
+		to := asOf.AddDate(0, 0, int(months/0.5*30))
+		e.From, e.To = &from, &to
+	}
+
+	e.History = history(dossiers, asOf)
+	return e, nil
+}
+
+// Summary describes an estimate in a few sentences, e.g. for a bot reply
+func (e Estimate) Summary() string {
+	var b strings.Builder
+	if e.AsOf.IsZero() {
+		return "There are no dated orders to estimate from yet."
+	}
+	category := "dossiers"
+	if e.Category != "" {
+		category = e.Category + " dossiers"
+	}
+
+	if e.Resolved == 0 {
+		fmt.Fprintf(&b, "Orders in the %d days up to %s resolved no %s of %d.", FrontWindow, e.AsOf.Format("2006-01-02"),
+			category, e.Year)
+	} else {
+		fmt.Fprintf(&b, "Orders in the %d days up to %s covered %s of %d up to number ~%s (median %s), and yours is %s.",
+			FrontWindow, e.AsOf.Format("2006-01-02"), category, e.Year, group(e.Highest), group(e.Median), group(e.Number))
+	}
+
+	switch {
+	case e.Resolved > 0 && e.Ahead <= 0:
+		b.WriteString(" The front has passed your number, so your dossier may be in an upcoming order or in one which isn't parsed yet.")
+	case e.From != nil:
+		fmt.Fprintf(&b, " The front moved about %s numbers a month over the last %d days, so your order could come roughly between %s and %s.",
+			group(uint(e.NumbersPerMonth+0.5)), RateWindow, e.From.Format("2006-01"), e.To.Format("2006-01"))
+	default:
+		b.WriteString(" The pace of the front can't be measured yet, so no date range can be projected.")
+	}
+	b.WriteString(" " + e.Caveat)
+	return b.String()
+}
+
+// resolvedDossiers reads the dossiers of a year with their order dates, oldest first
+func resolvedDossiers(ctx context.Context, db *sql.DB, year uint, category string) ([]resolved, error) {
+	rows, err := db.QueryContext(ctx, model.Get_Dossiers_by_Year, year, category)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dossiers of %d: %w", year, err)
+	}
+	defer rows.Close()
+
+	result := make([]resolved, 0)
+	for rows.Next() {
+		var (
+			r    resolved
+			date string
+		)
+		if err := rows.Scan(&date, &r.number); err != nil {
+			return nil, fmt.Errorf("error scanning dossier: %w", err)
+		}
+		if r.date, err = time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// numbersBetween returns the sorted numbers of the dossiers resolved after from, up to and including to
+func numbersBetween(dossiers []resolved, from, to time.Time) []uint {
+	numbers := make([]uint, 0)
+	for _, d := range dossiers {
+		if d.date.After(from) && !d.date.After(to) {
+			numbers = append(numbers, d.number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// history returns the monthly front of the HistoryMonths months up to asOf, months without orders left out
+func history(dossiers []resolved, asOf time.Time) []FrontPoint {
+	points := make([]FrontPoint, 0)
+	month := time.Date(asOf.Year(), asOf.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1-HistoryMonths, 0)
+	for i := 0; i < HistoryMonths; i++ {
+		next := month.AddDate(0, 1, 0)
+		numbers := numbersBetween(dossiers, month.AddDate(0, 0, -1), next.AddDate(0, 0, -1))
+		if len(numbers) > 0 {
+			points = append(points, FrontPoint{
+				Month:    month.Format("2006-01"),
+				Highest:  numbers[len(numbers)-1],
+				Median:   numbers[len(numbers)/2],
+				Dossiers: len(numbers),
+			})
+		}
+		month = next
+	}
+	return points
+}
+
+// group formats a number with thousands separators, e.g. 48,000
+func group(n uint) string {
+	s := fmt.Sprint(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
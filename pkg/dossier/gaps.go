@@ -0,0 +1,203 @@
+package dossier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"romaniabot/model"
+)
+
+// Verdicts of a missing dossier number
+const (
+	// VerdictParserMiss: the number is in the text of a parsed page, the parser didn't extract it
+	VerdictParserMiss = "parser_miss"
+	// VerdictUnparsed: an order file dated between the neighbours isn't parsed, the dossier may be in it
+	VerdictUnparsed = "unparsed_file"
+	// VerdictStuck: no trace of the number, the dossier is probably genuinely stuck
+	VerdictStuck = "stuck"
+)
+
+// GapOptions tune which missing numbers count as gaps
+type GapOptions struct {
+	Year        uint    // only this dossier year if not 0
+	MaxGap      int     // longest run of missing numbers reported, longer runs are unresolved ranges
+	Window      int     // numbers on each side of a gap the coverage is measured on
+	MinCoverage float64 // share of resolved numbers around a gap, 0..1, below which the gap isn't reported
+}
+
+// DefaultGapOptions are used by the gaps command unless overridden
+var DefaultGapOptions = GapOptions{MaxGap: 10, Window: 100, MinCoverage: 0.9}
+
+// Neighbour is the resolved dossier next to a gap
+type Neighbour struct {
+	Number    uint   `json:"number"`
+	Filename  string `json:"filename"`
+	OrderDate string `json:"orderDate"` // YYYY-MM-DD, empty if unknown
+}
+
+// Missing is an unresolved dossier number inside a gap with its cross-check verdict
+type Missing struct {
+	Number   uint   `json:"number"`
+	Verdict  string `json:"verdict"`
+	Evidence string `json:"evidence"` // page of a parser miss, unparsed files, or the neighbours of a stuck dossier
+}
+
+// Gap is a run of unresolved dossier numbers between two resolved ones, inside a mostly resolved range
+type Gap struct {
+	Year     uint      `json:"year"`
+	Category string    `json:"category"` // empty for dossiers without or with unknown category
+	Left     Neighbour `json:"left"`
+	Right    Neighbour `json:"right"`
+	Coverage float64   `json:"coverage"` // share of resolved numbers within Window of the gap
+	Missing  []Missing `json:"missing"`
+}
+
+// dossierRow is a resolved dossier as read for gap detection
+type dossierRow struct {
+	year     uint
+	category string
+	Neighbour
+}
+
+// Gaps finds runs of up to opts.MaxGap unresolved numbers between resolved dossiers of the same year and category,
+// where at least opts.MinCoverage of the numbers within opts.Window around the run are resolved. Every missing
+// number is checked against the page text index and the order files which aren't parsed.
+func Gaps(ctx context.Context, db *sql.DB, opts GapOptions) ([]Gap, error) {
+	rows, err := db.QueryContext(ctx, model.Get_Resolved_Dossiers, opts.Year)
+	if err != nil {
+		return nil, fmt.Errorf("error reading resolved dossiers: %w", err)
+	}
+	defer rows.Close()
+
+	// Resolved dossiers grouped by year and category, in number order
+	var groups [][]dossierRow
+	for rows.Next() {
+		var r dossierRow
+		if err := rows.Scan(&r.year, &r.category, &r.Number, &r.Filename, &r.OrderDate); err != nil {
+			return nil, fmt.Errorf("error scanning resolved dossier: %w", err)
+		}
+		last := len(groups) - 1
+		if last < 0 || groups[last][0].year != r.year || groups[last][0].category != r.category {
+			groups = append(groups, nil)
+			last++
+		}
+		groups[last] = append(groups[last], r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	gaps := make([]Gap, 0)
+	for _, group := range groups {
+		numbers := make([]uint, len(group))
+		for i, r := range group {
+			numbers[i] = r.Number
+		}
+		for i := 1; i < len(group); i++ {
+			left, right := group[i-1], group[i]
+			size := int(right.Number - left.Number - 1)
+			if size < 1 || size > opts.MaxGap {
+				continue
+			}
+			coverage := coverageAround(numbers, left.Number, right.Number, opts.Window)
+			if coverage < opts.MinCoverage {
+				continue
+			}
+			gap := Gap{Year: left.year, Category: left.category, Left: left.Neighbour, Right: right.Neighbour,
+				Coverage: coverage}
+			for n := left.Number + 1; n < right.Number; n++ {
+				missing, err := crossCheck(ctx, db, n, gap)
+				if err != nil {
+					return nil, err
+				}
+				gap.Missing = append(gap.Missing, missing)
+			}
+			gaps = append(gaps, gap)
+		}
+	}
+	return gaps, nil
+}
+
+// coverageAround returns the share of resolved numbers within window of the gap between left and right,
+// the gap itself included. The window ends at the lowest and highest resolved numbers.
+func coverageAround(numbers []uint, left, right uint, window int) float64 {
+	from, to := numbers[0], min(right+uint(window), numbers[len(numbers)-1])
+	if int(left)-window > int(from) {
+		from = left - uint(window)
+	}
+	first := sort.Search(len(numbers), func(i int) bool { return numbers[i] >= from })
+	last := sort.Search(len(numbers), func(i int) bool { return numbers[i] > to })
+	return float64(last-first) / float64(to-from+1)
+}
+
+// Unindexed returns the number of parsed order files whose page text isn't indexed, e.g. parsed before the index
+// existed; parser misses in them can't be found, so their dossiers are reported as stuck until search -reindex
+func Unindexed(ctx context.Context, db *sql.DB) (int, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, model.Count_Files_to_index).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting unindexed order files: %w", err)
+	}
+	return n, nil
+}
+
+// crossCheck tells why number is missing from the resolved dossiers of gap's year and category
+func crossCheck(ctx context.Context, db *sql.DB, number uint, gap Gap) (Missing, error) {
+	m := Missing{Number: number}
+
+	// The dossier the way orders print it, 12345/2019 or 12345/RD/2019 for the gap's category: the page index splits
+	// it into adjacent tokens, so other numbers near a year, like "nr. 102 din 2019", don't match
+	var (
+		filename string
+		page     int
+	)
+	match := fmt.Sprintf(`"%d %d"`, number, gap.Year)
+	if gap.Category != "" {
+		match = fmt.Sprintf(`"%d %s %d"`, number, strings.ToLower(gap.Category), gap.Year)
+	}
+	err := db.QueryRowContext(ctx, model.Find_Order_Page, match).Scan(&filename, &page)
+	switch {
+	case err == nil:
+		m.Verdict, m.Evidence = VerdictParserMiss, fmt.Sprintf("%s page %d", filename, page)
+		return m, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return m, fmt.Errorf("error searching pages for %d/%d: %w", number, gap.Year, err)
+	}
+
+	// Order files published around the neighbours' orders which weren't parsed
+	from, to := gap.Left.OrderDate, gap.Right.OrderDate
+	if from > to {
+		from, to = to, from
+	}
+	if from != "" {
+		rows, err := db.QueryContext(ctx, model.Get_Unparsed_Order_Files_between, from, to)
+		if err != nil {
+			return m, fmt.Errorf("error reading unparsed order files: %w", err)
+		}
+		defer rows.Close()
+		var files []string
+		for rows.Next() {
+			var name, state string
+			if err := rows.Scan(&name, &state); err != nil {
+				return m, fmt.Errorf("error scanning order file: %w", err)
+			}
+			files = append(files, name+" "+state)
+		}
+		if err := rows.Err(); err != nil {
+			return m, err
+		}
+		if len(files) > 0 {
+			m.Verdict, m.Evidence = VerdictUnparsed, strings.Join(files, ", ")
+			return m, nil
+		}
+	}
+
+	m.Verdict = VerdictStuck
+	m.Evidence = fmt.Sprintf("between %d in %s and %d in %s", gap.Left.Number, gap.Left.Filename,
+		gap.Right.Number, gap.Right.Filename)
+	return m, nil
+}
@@ -1,45 +1,55 @@
 package downloaders
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"path/filepath"
 	"romaniabot/pkg/fileutil"
+	"romaniabot/pkg/pipeline"
 	"romaniabot/pkg/web"
+	"strings"
 	"sync"
 	"time"
 )
 
+// AllowedContentType is the Content-Type expected for downloaded files; responses of other types are not saved.
+// Empty allows any type.
+var AllowedContentType = "application/pdf"
+
 // CheckDownloadedFiles is a function that checks if files have been downloaded.
 // It takes a path to save the files and a list of files to check.
 // It returns a slice of downloaded files.
-func CheckDownloadedFiles(pathForSave string, filesToCheck []string) []string {
+func CheckDownloadedFiles(pathForSave string, filesToCheck []string) ([]string, error) {
 	// Check if the directory exists. If it doesn't exist, create it automatically and skip checking for files in it.
 	var downloadedFiles []string
-	if fileutil.CheckDir(pathForSave) {
-		// Iterate over the files to check.
-		for _, k := range filesToCheck {
-			// Check if the file exists in the specified path.
-			if fileutil.CheckFile(pathForSave + k) {
-				// If the file exists, add it to the downloadedFiles slice.
-				downloadedFiles = append(downloadedFiles, k)
-			}
+	if err := fileutil.CheckDir(pathForSave); err != nil {
+		return nil, err
+	}
+	// Iterate over the files to check.
+	for _, k := range filesToCheck {
+		// Check if the file exists in the specified path.
+		if fileutil.CheckFile(filepath.Join(pathForSave, k)) {
+			// If the file exists, add it to the downloadedFiles slice.
+			downloadedFiles = append(downloadedFiles, k)
 		}
 	}
 	// Return the slice of downloaded files.
-	return downloadedFiles
+	return downloadedFiles, nil
 }
 
-// CheckBrokenURLs checks the availability of URLs and returns a slice of broken URLs
-func CheckBrokenURLs(URLs []string, maxRetries int, timeout time.Duration) []string {
-	// Create a slice to store the broken URLs
-	var brokenURLs []string
+// CheckBrokenURLs checks the availability of URLs and returns the broken URLs and the URLs which answered.
+// URLs denied by robots.txt or not checked because ctx was cancelled are in neither slice.
+func CheckBrokenURLs(ctx context.Context, URLs []string, maxRetries int, timeout time.Duration) (brokenURLs, availableURLs []string) {
 
 	// Create a WaitGroup to wait for all goroutines to finish
 	var wg sync.WaitGroup
 
 	// Create a channel to communicate the results of the goroutines
-	ch := make(chan string, len(URLs))
+	ch := make(chan pingResult, len(URLs))
 
 	// Iterate over each URL in the input slice
 	for _, url := range URLs {
@@ -57,24 +67,35 @@ func CheckBrokenURLs(URLs []string, maxRetries int, timeout time.Duration) []str
 			// Retry the request until the maximum number of retries is reached
 			for retries > 0 {
 				// Ping the URL and get the status code and error
-				status, err := web.Ping(u, timeout)
+				status, err := web.Ping(ctx, u, timeout)
+
+				// URLs denied by robots.txt are reported by the web package and aren't broken
+				if errors.Is(err, web.ErrDisallowed) {
+					ch <- pingResult{url: u}
+					return
+				}
 
 				// Check if there was an error or if the status code indicates a broken URL
 				if err != nil || status == 0 || status > 399 {
 					// Decrement the number of retries
 					retries--
 
-					// Sleep for the specified timeout before retrying
-					time.Sleep(timeout)
+					// Sleep for the specified timeout before retrying, unless cancelled
+					select {
+					case <-ctx.Done():
+						ch <- pingResult{url: u}
+						return
+					case <-time.After(timeout):
+					}
 				} else {
-					// If the URL is available, send an empty string to the channel and return
-					ch <- ""
+					// If the URL is available, report it and return
+					ch <- pingResult{url: u, available: true}
 					return
 				}
 			}
 
-			// If the URL is broken after all retries, send it to the channel
-			ch <- u
+			// If the URL is broken after all retries, report it
+			ch <- pingResult{url: u, broken: true}
 		}(url)
 	}
 
@@ -86,68 +107,110 @@ func CheckBrokenURLs(URLs []string, maxRetries int, timeout time.Duration) []str
 
 	// Iterate over the results received from the channel
 	for result := range ch {
-		// If the result is not an empty string, it means the URL is broken
-		if result != "" {
-			// Append the broken URL to the slice
-			brokenURLs = append(brokenURLs, result)
+		switch {
+		case result.broken:
+			brokenURLs = append(brokenURLs, result.url)
+			brokenURLsTotal.Inc()
+		case result.available:
+			availableURLs = append(availableURLs, result.url)
 		}
 	}
 
-	// Return the slice of broken URLs
-	return brokenURLs
+	return brokenURLs, availableURLs
+}
+
+// pingResult is the outcome of checking one URL; a URL which was neither broken nor available wasn't checked
+type pingResult struct {
+	url       string
+	broken    bool
+	available bool
 }
 
 // map[filename]url
-// Скачивает файлы. Получает путь для сохранения файлов и карту, состоящую из наименования файла для сохранения и ссылки на скачивание
-func Downloader(pathForSave string, filesURLS map[string]string) {
-	download(pathForSave, filesURLS)
+// Скачивает файлы. Получает путь для сохранения файлов и карту, состоящую из наименования файла для сохранения и ссылки на скачивание.
+// Returns the saved files; files which failed are returned as a *pipeline.Errors.
+func Downloader(ctx context.Context, pathForSave string, filesURLS map[string]string) ([]string, error) {
+	return download(ctx, pathForSave, filesURLS)
 }
 
 // Refactored download function
-func download(pathForSave string, filesURLS map[string]string) {
+func download(ctx context.Context, pathForSave string, filesURLS map[string]string) ([]string, error) {
+	if err := fileutil.CheckDir(pathForSave); err != nil {
+		return nil, err
+	}
+
 	var wg sync.WaitGroup // Create a wait group to wait for all goroutines to finish
 
 	wg.Add(len(filesURLS)) // Add the number of files to the wait group
 
 	var mu sync.Mutex // Create a mutex to synchronize access to shared resources
+	saved := make([]string, 0, len(filesURLS))
+	var failed pipeline.Errors
+
+	// fail records a failed download
+	fail := func(fname string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed.Add(pipeline.FileError(fname, err))
+	}
 
 	// Iterate over each file URL in the map
 	for fname, url := range filesURLS {
 		go func(fname, url string) { // Create a goroutine to download and save the file
 			defer wg.Done() // Notify the wait group that the goroutine has finished
 
-			req, err := http.NewRequest("GET", url, nil) // Create a new GET request
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil) // Create a new GET request
 			if err != nil {
-				log.Printf("error during request: %v\n", err) // Log any errors during request creation
+				fail(fname, fmt.Errorf("error creating request: %w", err)) // Record any errors during request creation
 				return
 			}
-			req.Header.Set("User-Agent", "RomanianBot/1.0") // Set the User-Agent header
 
-			client := &http.Client{}    // Create a new HTTP client
-			resp, err := client.Do(req) // Send the request and get the response
+			start := time.Now()                                  // Measure the download time
+			resp, err := web.NewCrawlClient(web.Timeout).Do(req) // Send the request through the shared crawl client and get the response
 			if err != nil {
-				log.Printf("error during connect to %s: %v\n", url, err) // Log any errors during connection
+				fail(fname, err) // Record any errors during connection
+				downloadDuration.Observe(time.Since(start).Seconds(), "error")
 				return
 			}
 			defer resp.Body.Close() // Close the response body when finished
 
+			// Skip error pages and other unexpected content instead of saving them as order files
+			if resp.StatusCode != http.StatusOK {
+				fail(fname, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url))
+				downloadDuration.Observe(time.Since(start).Seconds(), "error")
+				return
+			}
+			contentType := resp.Header.Get("Content-Type")
+			if AllowedContentType != "" && contentType != "" && !strings.HasPrefix(contentType, AllowedContentType) {
+				fail(fname, fmt.Errorf("unexpected content type %q from %s", contentType, url))
+				downloadDuration.Observe(time.Since(start).Seconds(), "error")
+				return
+			}
+
 			body, err := io.ReadAll(resp.Body) // Read the response body
 			if err != nil {
-				log.Printf("error reading response body: %v\n", err) // Log any errors during reading response body
+				fail(fname, fmt.Errorf("error reading response body: %w", err)) // Record any errors during reading response body
+				downloadDuration.Observe(time.Since(start).Seconds(), "error")
 				return
 			}
+			downloadDuration.Observe(time.Since(start).Seconds(), "ok")
+			downloadBytes.Add(float64(len(body)))
 
 			mu.Lock()         // Acquire the lock to synchronize access to shared resources
 			defer mu.Unlock() // Release the lock when finished
 
 			err = fileutil.WriteToFile(pathForSave, fname, body) // Write the file to disk
 			if err != nil {
-				log.Printf("error during writing file: %v\n", err) // Log any errors during writing file
+				failed.Add(pipeline.FileError(fname, fmt.Errorf("error writing file: %w", err))) // Record any errors during writing file
 				return
 			}
+			saved = append(saved, fname)
+			slog.InfoContext(ctx, "File saved", "file", fname, "bytes", len(body))
 		}(fname, url) // Pass the file name and URL to the goroutine
 	}
 
-	wg.Wait()                                      // Wait for all goroutines to finish
-	log.Println("All files downloaded and saved.") // Log a message indicating that all files have been downloaded and saved
+	wg.Wait() // Wait for all goroutines to finish
+	slog.InfoContext(ctx, "Downloads finished", "saved", len(saved), "failed", len(failed.Items))
+
+	return saved, failed.Err()
 }
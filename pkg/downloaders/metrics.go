@@ -0,0 +1,12 @@
+package downloaders
+
+import "romaniabot/pkg/metrics"
+
+var (
+	downloadBytes = metrics.NewCounter("romaniabot_download_bytes_total",
+		"Bytes of order files downloaded.")
+	downloadDuration = metrics.NewHistogram("romaniabot_download_duration_seconds",
+		"Time to download a single order file, by result.", nil, "result")
+	brokenURLsTotal = metrics.NewCounter("romaniabot_broken_urls_total",
+		"Order file URLs found broken after all retries.")
+)
@@ -0,0 +1,310 @@
+// Package export writes order files, dossiers and dossier occurrences for analysis tools such as pandas and DuckDB,
+// as CSV, JSON Lines or Parquet, optionally filtered and only the rows changed since a watermark.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+)
+
+// watermarkLayout is the format of watermarks and of the timestamps they are compared with, UTC
+const watermarkLayout = "2006-01-02 15:04:05"
+
+// Kind is the type of a column
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindDate // a day, YYYY-MM-DD in CSV and JSON Lines
+	KindTime // UTC to the second, RFC 3339 in CSV and JSON Lines
+)
+
+// Column is a column of a dataset
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// Dataset is a table which can be exported; its last column is updatedAt, the column watermarks apply to
+type Dataset struct {
+	Name    string
+	Columns []Column
+	query   string
+}
+
+// Datasets are the exportable tables
+var Datasets = []Dataset{
+	{
+		Name: "order-files",
+		Columns: []Column{
+			{"filename", KindString}, {"date", KindString}, {"orderDate", KindDate}, {"url", KindString},
+			{"name", KindString}, {"orderNumber", KindInt}, {"orderSeries", KindString}, {"source", KindString},
+			{"state", KindString}, {"fileHash", KindString}, {"fileSize", KindInt}, {"dossiers", KindInt},
+			{"createdAt", KindTime}, {"updatedAt", KindTime},
+		},
+		query: model.Export_Order_Files,
+	},
+	{
+		Name: "orders",
+		Columns: []Column{
+			{"filename", KindString}, {"dossier", KindString}, {"number", KindInt}, {"year", KindInt},
+			{"category", KindString}, {"createdAt", KindTime}, {"updatedAt", KindTime},
+		},
+		query: model.Export_Orders,
+	},
+	{
+		// Every dossier with the order file it was found in, ready for analysis without a join
+		Name: "occurrences",
+		Columns: []Column{
+			{"dossier", KindString}, {"number", KindInt}, {"year", KindInt}, {"category", KindString},
+			{"filename", KindString}, {"orderDate", KindDate}, {"orderNumber", KindInt}, {"orderSeries", KindString},
+			{"source", KindString}, {"url", KindString}, {"updatedAt", KindTime},
+		},
+		query: model.Export_Occurrences,
+	},
+}
+
+// Formats are the supported output formats
+var Formats = []string{"csv", "jsonl", "parquet"}
+
+// DatasetByName returns the dataset called name
+func DatasetByName(name string) (Dataset, bool) {
+	for _, d := range Datasets {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// Filter selects the exported rows; zero fields don't filter
+type Filter struct {
+	Source string // listing page the order files were found on
+	From   string // first order date, YYYY-MM-DD
+	To     string // last order date, YYYY-MM-DD
+	Year   uint   // dossier year; order files containing dossiers of that year
+	Since  string // watermark returned by an earlier export, see ParseWatermark
+}
+
+// Result tells what an export wrote
+type Result struct {
+	Rows int
+	// Watermark is the latest updatedAt exported, or Filter.Since if nothing was, to pass as Since to the next
+	// export. Rows changed at the watermark second are exported again, so consumers should upsert by key.
+	Watermark string
+}
+
+// ParseWatermark reads a watermark as RFC 3339, "YYYY-MM-DD HH:MM:SS" UTC or a date, returning it in the format
+// Result.Watermark has
+func ParseWatermark(s string) (string, error) {
+	for _, layout := range []string{time.RFC3339, watermarkLayout, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.UTC().Format(watermarkLayout), nil
+		}
+	}
+	return "", fmt.Errorf("invalid watermark %q, expected e.g. 2026-10-01 12:00:00 or 2026-10-01T12:00:00Z", s)
+}
+
+// Write exports the rows of a dataset matching filter to w in format
+func Write(ctx context.Context, db *sql.DB, w io.Writer, d Dataset, format string, filter Filter) (Result, error) {
+	result := Result{Watermark: filter.Since}
+
+	var out writer
+	switch format {
+	case "csv":
+		out = newCSV(w, d.Columns)
+	case "jsonl":
+		out = &jsonlWriter{w: w, columns: d.Columns}
+	case "parquet":
+		p, err := newParquet(w, d.Columns)
+		if err != nil {
+			return result, fmt.Errorf("error writing parquet header: %w", err)
+		}
+		out = p
+	default:
+		return result, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+
+	rows, err := db.QueryContext(ctx, d.query, filter.Since, filter.Source, filter.From, filter.To, filter.Year)
+	if err != nil {
+		return result, fmt.Errorf("error reading %s: %w", d.Name, err)
+	}
+	defer rows.Close()
+
+	raw := make([]any, len(d.Columns))
+	dest := make([]any, len(d.Columns))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return result, fmt.Errorf("error scanning %s: %w", d.Name, err)
+		}
+		row := make([]any, len(d.Columns))
+		for i, column := range d.Columns {
+			row[i] = convert(column.Kind, raw[i])
+		}
+		if err := out.Write(row); err != nil {
+			return result, fmt.Errorf("error writing %s: %w", d.Name, err)
+		}
+		result.Rows++
+		// Rows come in updatedAt order
+		if updated, ok := raw[len(raw)-1].(string); ok && updated > result.Watermark {
+			result.Watermark = updated
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+	if err := out.Close(); err != nil {
+		return result, fmt.Errorf("error writing %s: %w", d.Name, err)
+	}
+	return result, nil
+}
+
+// convert turns a database value into the Go value of a column kind: string, int64 or time.Time; nil stays nil,
+// as do dates and times which can't be parsed
+func convert(kind Kind, v any) any {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if v == nil {
+		return nil
+	}
+	switch kind {
+	case KindInt:
+		switch n := v.(type) {
+		case int64:
+			return n
+		case float64:
+			return int64(n)
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return i
+			}
+		}
+		return nil
+	case KindDate, KindTime:
+		s, _ := v.(string)
+		layout := "2006-01-02"
+		if kind == KindTime {
+			layout = watermarkLayout
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return nil
+		}
+		return t
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// format formats a value for CSV and JSON Lines
+func format(kind Kind, v any) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		if kind == KindDate {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// writer writes the rows of one export
+type writer interface {
+	Write(row []any) error
+	Close() error
+}
+
+// csvWriter writes a header line and a line per row; null values are empty
+type csvWriter struct {
+	w       *csv.Writer
+	columns []Column
+	header  bool
+}
+
+func newCSV(w io.Writer, columns []Column) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w), columns: columns}
+}
+
+func (c *csvWriter) Write(row []any) error {
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(row))
+	for i, v := range row {
+		record[i] = format(c.columns[i].Kind, v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) writeHeader() error {
+	c.header = true
+	names := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		names[i] = column.Name
+	}
+	return c.w.Write(names)
+}
+
+// Close writes the header of an empty export and flushes
+func (c *csvWriter) Close() error {
+	if !c.header {
+		if err := c.writeHeader(); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// jsonlWriter writes a JSON object per row with the columns in dataset order; null values are null
+type jsonlWriter struct {
+	w       io.Writer
+	columns []Column
+}
+
+func (j *jsonlWriter) Write(row []any) error {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range row {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(j.columns[i].Name)
+		b.Write(name)
+		b.WriteByte(':')
+		switch v.(type) {
+		case nil:
+			b.WriteString("null")
+		case int64:
+			b.WriteString(format(j.columns[i].Kind, v))
+		default:
+			value, _ := json.Marshal(format(j.columns[i].Kind, v))
+			b.Write(value)
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(j.w, b.String())
+	return err
+}
+
+func (j *jsonlWriter) Close() error { return nil }
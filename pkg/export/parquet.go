@@ -0,0 +1,334 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// rowGroupSize is the number of rows buffered before a Parquet row group is written
+const rowGroupSize = 100_000
+
+// Parquet physical and converted types, repetitions, encodings and thrift compact types, see parquet.thrift
+const (
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	convertedUTF8            = 0
+	convertedDate            = 6
+	convertedTimestampMillis = 9
+
+	repetitionOptional = 1
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetWriter writes a Parquet file with a flat schema of optional columns: plain encoded, uncompressed data
+// pages, one page per column chunk. Rows are buffered and written rowGroupSize at a time, the footer on Close.
+type parquetWriter struct {
+	w       io.Writer
+	columns []Column
+	offset  int64
+	rows    [][]any
+	groups  []rowGroup
+	total   int64
+}
+
+// rowGroup is the footer metadata of a written row group
+type rowGroup struct {
+	rows   int64
+	chunks []columnChunk
+}
+
+// columnChunk is the footer metadata of a written column chunk
+type columnChunk struct {
+	offset int64 // of its data page header
+	size   int64 // page header and data
+	values int64
+}
+
+func newParquet(w io.Writer, columns []Column) (*parquetWriter, error) {
+	if _, err := w.Write([]byte("PAR1")); err != nil {
+		return nil, err
+	}
+	return &parquetWriter{w: w, columns: columns, offset: 4}, nil
+}
+
+func (p *parquetWriter) Write(row []any) error {
+	p.rows = append(p.rows, row)
+	if len(p.rows) >= rowGroupSize {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	footer := p.footer()
+	var tail [4]byte
+	binary.LittleEndian.PutUint32(tail[:], uint32(len(footer)))
+	for _, b := range [][]byte{footer, tail[:], []byte("PAR1")} {
+		if _, err := p.w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered rows as a row group
+func (p *parquetWriter) flush() error {
+	if len(p.rows) == 0 {
+		return nil
+	}
+	group := rowGroup{rows: int64(len(p.rows))}
+	for i, column := range p.columns {
+		// Definition levels: 1 for a value, 0 for null; then the values which aren't null
+		var levels []byte
+		var values bytes.Buffer
+		for _, row := range p.rows {
+			if row[i] == nil {
+				levels = append(levels, 0)
+				continue
+			}
+			levels = append(levels, 1)
+			if err := plain(&values, column.Kind, row[i]); err != nil {
+				return fmt.Errorf("error encoding column %s: %w", column.Name, err)
+			}
+		}
+		encoded := rle(levels)
+		var page bytes.Buffer
+		binary.Write(&page, binary.LittleEndian, uint32(len(encoded)))
+		page.Write(encoded)
+		page.Write(values.Bytes())
+
+		var header thrift
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.structBegin(5)
+		header.i32(1, int32(len(p.rows)))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.structEnd()
+		header.stop()
+
+		chunk := columnChunk{offset: p.offset, size: int64(header.buf.Len() + page.Len()), values: int64(len(p.rows))}
+		for _, b := range [][]byte{header.buf.Bytes(), page.Bytes()} {
+			if _, err := p.w.Write(b); err != nil {
+				return err
+			}
+		}
+		p.offset += chunk.size
+		group.chunks = append(group.chunks, chunk)
+	}
+	p.groups = append(p.groups, group)
+	p.total += group.rows
+	p.rows = p.rows[:0]
+	return nil
+}
+
+// footer returns the FileMetaData of the written row groups
+func (p *parquetWriter) footer() []byte {
+	var t thrift
+	t.i32(1, 1) // version
+	t.listBegin(2, thriftStruct, len(p.columns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.elemEnd()
+	for _, column := range p.columns {
+		physical, converted := parquetType(column.Kind)
+		t.elemBegin()
+		t.i32(1, physical)
+		t.i32(3, repetitionOptional)
+		t.binary(4, column.Name)
+		t.i32(6, converted)
+		t.elemEnd()
+	}
+	t.i64(3, p.total)
+	t.listBegin(4, thriftStruct, len(p.groups))
+	for _, group := range p.groups {
+		t.elemBegin()
+		t.listBegin(1, thriftStruct, len(group.chunks))
+		var size int64
+		for i, chunk := range group.chunks {
+			physical, _ := parquetType(p.columns[i].Kind)
+			size += chunk.size
+			t.elemBegin()
+			t.i64(2, chunk.offset)
+			t.structBegin(3)
+			t.i32(1, physical)
+			t.listBegin(2, thriftI32, 2)
+			t.varint(encodingPlain)
+			t.varint(encodingRLE)
+			t.listBegin(3, thriftBinary, 1)
+			t.str(p.columns[i].Name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.structEnd()
+			t.elemEnd()
+		}
+		t.i64(2, size)
+		t.i64(3, group.rows)
+		t.elemEnd()
+	}
+	t.binary(6, "romaniabot")
+	t.stop()
+	return t.buf.Bytes()
+}
+
+// parquetType returns the physical and converted type of a column kind
+func parquetType(kind Kind) (int32, int32) {
+	switch kind {
+	case KindInt:
+		return parquetInt64, -1
+	case KindDate:
+		return parquetInt32, convertedDate
+	case KindTime:
+		return parquetInt64, convertedTimestampMillis
+	default:
+		return parquetByteArray, convertedUTF8
+	}
+}
+
+// plain appends a value in the PLAIN encoding of its column kind
+func plain(buf *bytes.Buffer, kind Kind, v any) error {
+	switch kind {
+	case KindInt:
+		n, ok := v.(int64)
+		if !ok {
+			return fmt.Errorf("%v is not an integer", v)
+		}
+		return binary.Write(buf, binary.LittleEndian, n)
+	case KindDate:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("%v is not a date", v)
+		}
+		// Days since the Unix epoch
+		return binary.Write(buf, binary.LittleEndian, int32(t.Unix()/86400))
+	case KindTime:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("%v is not a time", v)
+		}
+		return binary.Write(buf, binary.LittleEndian, t.UnixMilli())
+	default:
+		s := fmt.Sprint(v)
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+		return nil
+	}
+}
+
+// rle encodes levels of bit width 1 as runs of the RLE/bit-packing hybrid encoding
+func rle(levels []byte) []byte {
+	var out []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, levels[i])
+		i = j
+	}
+	return out
+}
+
+// thrift writes the thrift compact protocol, only the parts Parquet metadata needs.
+// A field of a negative i32 value is left out, for optional fields which aren't set.
+type thrift struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field of every open struct, the innermost last
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	last := int16(0)
+	if len(t.last) > 0 {
+		last = t.last[len(t.last)-1]
+	} else {
+		t.last = append(t.last, 0)
+	}
+	if delta := id - last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	t.last[len(t.last)-1] = id
+}
+
+// varint writes a zigzag varint
+func (t *thrift) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], uint64((v<<1)^(v>>63)))])
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	if v < 0 {
+		return
+	}
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.str(s)
+}
+
+// str writes a string without field header, as a binary field or list element; lengths aren't zigzag encoded
+func (t *thrift) str(s string) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	t.buf.WriteString(s)
+}
+
+func (t *thrift) listBegin(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (t *thrift) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.last = append(t.last, 0)
+}
+
+func (t *thrift) structEnd() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// elemBegin starts a struct element of a list, which has no field header
+func (t *thrift) elemBegin() { t.last = append(t.last, 0) }
+
+func (t *thrift) elemEnd() { t.structEnd() }
+
+// stop ends the top-level struct
+func (t *thrift) stop() { t.buf.WriteByte(0) }
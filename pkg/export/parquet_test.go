@@ -0,0 +1,426 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/orders.parquet")
+
+// fixturePath is a file written by parquetWriter from fixtureRows; TestParquetPyarrow checks that pyarrow reads it
+var fixturePath = filepath.Join("testdata", "orders.parquet")
+
+var (
+	fixtureColumns = []Column{{Name: "id", Kind: KindInt}, {Name: "name", Kind: KindString}, {Name: "date", Kind: KindDate}, {Name: "updated", Kind: KindTime}}
+	fixtureRows    = [][]any{
+		{int64(1), "Ion Popescu", time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC), time.Date(2023, 5, 17, 9, 30, 15, 0, time.UTC)},
+		{nil, "", nil, nil},
+		{int64(-7), nil, time.Date(1963, 5, 17, 0, 0, 0, 0, time.UTC), time.Date(2023, 5, 17, 8, 30, 15, 0, time.UTC)},
+		{nil, nil, nil, nil},
+		{int64(1 << 40), "Ștefan Ăîâșț", time.Date(2023, 5, 17, 0, 0, 0, 0, time.UTC), time.Date(2023, 5, 17, 9, 30, 15, 0, time.UTC)},
+	}
+)
+
+// writeParquet returns rows written by parquetWriter
+func writeParquet(t *testing.T, columns []Column, rows [][]any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	p, err := newParquet(&buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := p.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestParquetFixture keeps the writer output equal to the fixture read by pyarrow; run with -update after
+// a deliberate change of the format, then check the new fixture with TestParquetPyarrow
+func TestParquetFixture(t *testing.T) {
+	got := writeParquet(t, fixtureColumns, fixtureRows)
+	if *update {
+		if err := os.WriteFile(fixturePath, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("writer output differs from %s", fixturePath)
+	}
+}
+
+// pyarrowRead prints the column types and values of a Parquet file as JSON; dates as YYYY-MM-DD,
+// times as milliseconds since the Unix epoch
+const pyarrowRead = `
+import json, sys
+import pyarrow as pa, pyarrow.compute as pc, pyarrow.parquet as pq
+table = pq.read_table(sys.argv[1])
+types, columns = {}, {}
+for field, column in zip(table.schema, table.columns):
+    types[field.name] = str(field.type)
+    if pa.types.is_timestamp(field.type):
+        types[field.name] = "timestamp[%s]" % field.type.unit
+        column = pc.cast(column, pa.int64())
+    elif pa.types.is_date(field.type):
+        column = pc.cast(column, pa.string())
+    columns[field.name] = column.to_pylist()
+print(json.dumps({"rows": table.num_rows, "types": types, "columns": columns}))
+`
+
+// TestParquetPyarrow checks that pyarrow, as used by pandas, reads the fixture; skipped without pyarrow
+func TestParquetPyarrow(t *testing.T) {
+	if err := exec.Command("python3", "-c", "import pyarrow.parquet").Run(); err != nil {
+		t.Skip("pyarrow isn't installed")
+	}
+	out, err := exec.Command("python3", "-c", pyarrowRead, fixturePath).Output()
+	if err != nil {
+		t.Fatalf("pyarrow can't read %s: %v", fixturePath, err)
+	}
+	var got any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("error decoding pyarrow output %q: %v", out, err)
+	}
+
+	types := map[Kind]string{KindInt: "int64", KindString: "string", KindDate: "date32[day]", KindTime: "timestamp[ms]"}
+	want := map[string]any{"rows": len(fixtureRows), "types": map[string]any{}, "columns": map[string]any{}}
+	for i, column := range fixtureColumns {
+		want["types"].(map[string]any)[column.Name] = types[column.Kind]
+		values := make([]any, len(fixtureRows))
+		for r, row := range fixtureRows {
+			switch v := row[i].(type) {
+			case time.Time:
+				if column.Kind == KindDate {
+					values[r] = v.Format(time.DateOnly)
+				} else {
+					values[r] = v.UnixMilli()
+				}
+			default:
+				values[r] = v
+			}
+		}
+		want["columns"].(map[string]any)[column.Name] = values
+	}
+	// Compared as decoded JSON, so numbers are float64 on both sides
+	data, _ := json.Marshal(want)
+	var wantJSON any
+	json.Unmarshal(data, &wantJSON)
+
+	if !reflect.DeepEqual(got, wantJSON) {
+		t.Errorf("pyarrow read %s, want %s", out, data)
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	mixed := fixtureColumns
+
+	// 14 columns and the root are the shortest schema list which needs the long list header
+	var wide []Column
+	wideRow := make([]any, 14)
+	for i := range wideRow {
+		wide = append(wide, Column{Name: fmt.Sprintf("c%d", i), Kind: KindInt})
+		wideRow[i] = int64(i)
+	}
+
+	// A run of 200 definition levels has a multi-byte header
+	var nulls [][]any
+	for i := 0; i < 200; i++ {
+		nulls = append(nulls, []any{nil})
+	}
+	nulls = append(nulls, []any{"last"})
+
+	// One row more than a row group
+	var many [][]any
+	for i := 0; i <= rowGroupSize; i++ {
+		many = append(many, []any{int64(i)})
+	}
+
+	tests := []struct {
+		name    string
+		columns []Column
+		rows    [][]any
+		groups  int
+	}{
+		{
+			name:    "no rows",
+			columns: mixed,
+		},
+		{
+			name:    "all kinds with nulls",
+			columns: mixed,
+			rows:    fixtureRows,
+			groups:  1,
+		},
+		{
+			name:    "wide schema",
+			columns: wide,
+			rows:    [][]any{wideRow, wideRow},
+			groups:  1,
+		},
+		{
+			name:    "long null run",
+			columns: []Column{{Name: "name", Kind: KindString}},
+			rows:    nulls,
+			groups:  1,
+		},
+		{
+			name:    "two row groups",
+			columns: []Column{{Name: "id", Kind: KindInt}},
+			rows:    many,
+			groups:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, rows, groups, err := readParquet(writeParquet(t, tt.columns, tt.rows))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("columns = %v, want %v", columns, tt.columns)
+			}
+			if groups != tt.groups {
+				t.Errorf("row groups = %d, want %d", groups, tt.groups)
+			}
+			if len(rows) != len(tt.rows) {
+				t.Fatalf("rows = %d, want %d", len(rows), len(tt.rows))
+			}
+			for i := range rows {
+				if !reflect.DeepEqual(rows[i], tt.rows[i]) {
+					t.Errorf("row %d = %v, want %v", i, rows[i], tt.rows[i])
+				}
+			}
+		})
+	}
+}
+
+// readParquet decodes a file written by parquetWriter: its columns, rows and number of row groups
+func readParquet(data []byte) ([]Column, [][]any, int, error) {
+	if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		return nil, nil, 0, fmt.Errorf("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if size > len(data)-12 {
+		return nil, nil, 0, fmt.Errorf("footer length %d out of range", size)
+	}
+	meta, err := readStruct(bytes.NewReader(data[len(data)-8-size : len(data)-8]))
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("error reading footer: %w", err)
+	}
+
+	// The first schema element is the root, the others the columns
+	schema := meta[2].([]any)
+	if n := schema[0].(map[int16]any)[5]; n != int64(len(schema)-1) {
+		return nil, nil, 0, fmt.Errorf("root has %v children, want %d", n, len(schema)-1)
+	}
+	var columns []Column
+	for _, e := range schema[1:] {
+		element := e.(map[int16]any)
+		if element[3] != int64(repetitionOptional) {
+			return nil, nil, 0, fmt.Errorf("column %v isn't optional", element[4])
+		}
+		var kind Kind
+		switch physical, converted := element[1], element[6]; {
+		case physical == int64(parquetInt64) && converted == nil:
+			kind = KindInt
+		case physical == int64(parquetInt32) && converted == int64(convertedDate):
+			kind = KindDate
+		case physical == int64(parquetInt64) && converted == int64(convertedTimestampMillis):
+			kind = KindTime
+		case physical == int64(parquetByteArray) && converted == int64(convertedUTF8):
+			kind = KindString
+		default:
+			return nil, nil, 0, fmt.Errorf("column %v has physical type %v and converted type %v", element[4], physical, converted)
+		}
+		columns = append(columns, Column{Name: element[4].(string), Kind: kind})
+	}
+
+	var rows [][]any
+	groups, _ := meta[4].([]any)
+	for _, g := range groups {
+		group := g.(map[int16]any)
+		n := int(group[3].(int64))
+		values := make([][]any, len(columns))
+		for i, c := range group[1].([]any) {
+			chunk := c.(map[int16]any)[3].(map[int16]any)
+			if chunk[5] != int64(n) {
+				return nil, nil, 0, fmt.Errorf("column %d has %v values, want %d", i, chunk[5], n)
+			}
+			values[i], err = readPage(data, int(chunk[9].(int64)), columns[i].Kind, n)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("column %s: %w", columns[i].Name, err)
+			}
+		}
+		for r := 0; r < n; r++ {
+			row := make([]any, len(columns))
+			for i := range columns {
+				row[i] = values[i][r]
+			}
+			rows = append(rows, row)
+		}
+	}
+	if meta[3] != int64(len(rows)) {
+		return nil, nil, 0, fmt.Errorf("footer has %v rows, row groups %d", meta[3], len(rows))
+	}
+	return columns, rows, len(groups), nil
+}
+
+// readPage decodes the data page at offset: n values of kind, nil for nulls
+func readPage(data []byte, offset int, kind Kind, n int) ([]any, error) {
+	r := bytes.NewReader(data[offset:])
+	header, err := readStruct(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading page header: %w", err)
+	}
+	page := make([]byte, header[3].(int64))
+	if _, err := io.ReadFull(r, page); err != nil {
+		return nil, fmt.Errorf("error reading page: %w", err)
+	}
+	if values := header[5].(map[int16]any)[1]; values != int64(n) {
+		return nil, fmt.Errorf("page has %v values, want %d", values, n)
+	}
+
+	// Definition levels, as RLE runs of bit width 1
+	r = bytes.NewReader(page)
+	var length uint32
+	binary.Read(r, binary.LittleEndian, &length)
+	levels := bytes.NewReader(page[4 : 4+length])
+	r.Seek(int64(4+length), io.SeekStart)
+	var defined []bool
+	for levels.Len() > 0 {
+		run, err := binary.ReadUvarint(levels)
+		if err != nil || run&1 != 0 {
+			return nil, fmt.Errorf("bad level run header %d", run)
+		}
+		level, _ := levels.ReadByte()
+		for i := uint64(0); i < run>>1; i++ {
+			defined = append(defined, level == 1)
+		}
+	}
+	if len(defined) != n {
+		return nil, fmt.Errorf("%d definition levels, want %d", len(defined), n)
+	}
+
+	values := make([]any, n)
+	for i := range values {
+		if !defined[i] {
+			continue
+		}
+		switch kind {
+		case KindInt:
+			var v int64
+			err = binary.Read(r, binary.LittleEndian, &v)
+			values[i] = v
+		case KindDate:
+			var v int32
+			err = binary.Read(r, binary.LittleEndian, &v)
+			values[i] = time.Unix(int64(v)*86400, 0).UTC()
+		case KindTime:
+			var v int64
+			err = binary.Read(r, binary.LittleEndian, &v)
+			values[i] = time.UnixMilli(v).UTC()
+		default:
+			var size uint32
+			binary.Read(r, binary.LittleEndian, &size)
+			s := make([]byte, size)
+			_, err = io.ReadFull(r, s)
+			values[i] = string(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading value %d: %w", i, err)
+		}
+	}
+	if r.Len() != 0 {
+		return nil, fmt.Errorf("%d bytes left after the values", r.Len())
+	}
+	return values, nil
+}
+
+// readStruct decodes a thrift compact struct into its fields by id; integers are int64, binaries strings,
+// lists []any and structs map[int16]any
+func readStruct(r *bytes.Reader) (map[int16]any, error) {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return fields, nil
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, err := readVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if fields[id], err = readValue(r, b&0x0f); err != nil {
+			return nil, fmt.Errorf("field %d: %w", id, err)
+		}
+		last = id
+	}
+}
+
+func readValue(r *bytes.Reader, typ byte) (any, error) {
+	switch typ {
+	case thriftI32, thriftI64:
+		return readVarint(r)
+	case thriftBinary:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		s := make([]byte, n)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	case thriftList:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(b >> 4)
+		if n == 15 {
+			if n, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		list := make([]any, n)
+		for i := range list {
+			if list[i], err = readValue(r, b&0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case thriftStruct:
+		return readStruct(r)
+	default:
+		return nil, fmt.Errorf("unexpected thrift type %d", typ)
+	}
+}
+
+// readVarint reads a zigzag varint
+func readVarint(r *bytes.Reader) (int64, error) {
+	u, err := binary.ReadUvarint(r)
+	return int64(u>>1) ^ -int64(u&1), err
+}
@@ -0,0 +1,95 @@
+package extractors
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout used to store order dates in the database (ISO 8601 date)
+const DateLayout = "2006-01-02"
+
+var (
+	// 26.10.2023, 2.11.2023, 26/10/2023, 26-10-2023, 26.10.23
+	reNumericDate = regexp.MustCompile(`^(\d{1,2})\s*[./\-,]\s*(\d{1,2})\s*[./\-,]\s*(\d{4}|\d{2})$`)
+	// 2023-10-26
+	reISODate = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	// 26 octombrie 2023
+	reWordDate = regexp.MustCompile(`^(\d{1,2})\s+([a-zăâîșşțţ]+)\.?\s+(\d{4})$`)
+)
+
+// romanianMonths maps Romanian month names and their short forms to months
+var romanianMonths = map[string]time.Month{
+	"ianuarie": time.January, "ian": time.January,
+	"februarie": time.February, "feb": time.February,
+	"martie": time.March, "mar": time.March,
+	"aprilie": time.April, "apr": time.April,
+	"mai":   time.May,
+	"iunie": time.June, "iun": time.June,
+	"iulie": time.July, "iul": time.July,
+	"august": time.August, "aug": time.August,
+	"septembrie": time.September, "sep": time.September, "sept": time.September,
+	"octombrie": time.October, "oct": time.October,
+	"noiembrie": time.November, "noi": time.November, "nov": time.November,
+	"decembrie": time.December, "dec": time.December,
+}
+
+// ParseDate parses an order date as printed on the listing pages and returns it as a UTC date.
+// Supported: "26.10.2023", "2.11.2023", "26/10/2023", "26-10-2023", "26.10.23", "2023-10-26", "26 octombrie 2023".
+// Surrounding spaces, &nbsp; and trailing dots are ignored.
+func ParseDate(raw string) (time.Time, error) {
+	s := strings.ToLower(collapseSpaces(raw))
+	s = strings.TrimRight(s, ".,; ")
+
+	if s == "" {
+		return time.Time{}, fmt.Errorf("error parsing date %q: empty date", raw)
+	}
+
+	var day, month, year int
+	switch {
+	case reNumericDate.MatchString(s):
+		m := reNumericDate.FindStringSubmatch(s)
+		day, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		year, _ = strconv.Atoi(m[3])
+		// Two-digit years are always 20xx on this site
+		if len(m[3]) == 2 {
+			year += 2000
+		}
+	case reISODate.MatchString(s):
+		m := reISODate.FindStringSubmatch(s)
+		year, _ = strconv.Atoi(m[1])
+		month, _ = strconv.Atoi(m[2])
+		day, _ = strconv.Atoi(m[3])
+	case reWordDate.MatchString(s):
+		m := reWordDate.FindStringSubmatch(s)
+		mon, ok := romanianMonths[stripDiacritics(m[2])]
+		if !ok {
+			return time.Time{}, fmt.Errorf("error parsing date %q: unknown month %q", raw, m[2])
+		}
+		day, _ = strconv.Atoi(m[1])
+		month = int(mon)
+		year, _ = strconv.Atoi(m[3])
+	default:
+		return time.Time{}, fmt.Errorf("error parsing date %q: unknown format", raw)
+	}
+
+	if year < 2010 || year > 2050 {
+		return time.Time{}, fmt.Errorf("error parsing date %q: invalid year %d", raw, year)
+	}
+
+	// time.Date normalizes out-of-range values (31.02 -> 03.03), so check the round trip
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day || int(t.Month()) != month {
+		return time.Time{}, fmt.Errorf("error parsing date %q: invalid day or month", raw)
+	}
+
+	return t, nil
+}
+
+// stripDiacritics replaces Romanian letters with diacritics by their ASCII counterparts
+func stripDiacritics(s string) string {
+	return strings.NewReplacer("ă", "a", "â", "a", "î", "i", "ș", "s", "ş", "s", "ț", "t", "ţ", "t").Replace(s)
+}
@@ -0,0 +1,49 @@
+package extractors
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string // YYYY-MM-DD, empty for an error
+	}{
+		{"26.10.2023", "2023-10-26"},
+		{"2.11.2023", "2023-11-02"},
+		{"26/10/2023", "2023-10-26"},
+		{"26-10-2023", "2023-10-26"},
+		{"26.10.23", "2023-10-26"},
+		{"26 . 10 . 2023", "2023-10-26"},
+		{" 26.10.2023. ", "2023-10-26"},
+		{"2023-10-26", "2023-10-26"},
+		{"26 octombrie 2023", "2023-10-26"},
+		{"1 Septembrie 2023", "2023-09-01"},
+		{"3 febr 2023", ""},
+		{"29.02.2024", "2024-02-29"},
+		{"29.02.2023", ""},
+		{"31.04.2023", ""},
+		{"26.13.2023", ""},
+		{"26.10.2009", ""},
+		{"26.10.2051", ""},
+		{"", ""},
+		{"ieri", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.raw)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseDate(%q) = %s, want an error", tt.raw, got.Format(DateLayout))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", tt.raw, err)
+			continue
+		}
+		if got.Format(DateLayout) != tt.want || got.Location() != time.UTC {
+			t.Errorf("ParseDate(%q) = %v, want %s UTC", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -4,214 +4,151 @@ package extractors
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
+	"path"
 	"path/filepath"
 	"romaniabot/model"
+	"romaniabot/pkg/pipeline"
 	"strconv"
 	"strings"
+	"time"
 
-	"io"
 	"regexp"
 
 	"github.com/ledongthuc/pdf"
-
-	"golang.org/x/net/html"
-	"golang.org/x/net/html/atom"
 )
 
 type orderLocal struct {
 	Number            uint
 	Year              uint
 	FullNameFormatted string
+	Category          string
 }
 
-// InsideTags saves all tags with attributes and text between <li> tags
-// Returns: "<li>Data de&nbsp;<strong>26.10.2023&nbsp;</strong>numărul:&nbsp;&nbsp;<a href="https://cetatenie.just.ro/wp-content/uploads/2022/01/Ordin-1795-P-26.10.2023-art-11.pdf">1795P</a>&nbsp;<a href="https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1796-P-26.10.2023-art-11.pdf">1796P</a>&nbsp;&nbsp;<a href="https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1797-din-26.10.2023-art-11.pdf">1797P</a></li>"
-func InsideTags(z *html.Tokenizer, tag atom.Atom) (string, error) {
-	var result strings.Builder
-
-	if z == nil {
-		return "", fmt.Errorf("error during extracting tags: html.Tokenizer nil is received")
-	}
-
-	for {
-		tt := z.Next()
-		token := z.Token()
-		result.WriteString(token.String())
-
-		if tt == html.ErrorToken || (tt == html.EndTagToken && token.DataAtom == tag) {
-			break
-		}
-	}
-
-	if strings.Contains(result.String(), "<strong>") && strings.Contains(result.String(), "href") {
-		return result.String(), nil
-	}
-	return "", nil
-}
-
-// StrongText returns the text content within <strong> tags
-// Returns: "26.10.2023"
-func StrongText(htmlString string) (string, error) {
-	doc, err := html.Parse(strings.NewReader(htmlString))
+// Filename returns the name an order file is stored under: the last segment of its URL path, without query
+// Example: "https://cetatenie.just.ro/wp-content/uploads/2022/01/Ordin-1795-P.pdf?ver=2" -> "Ordin-1795-P.pdf"
+func Filename(rawURL string) string {
+	u, err := url.Parse(rawURL)
 	if err != nil {
-		return "", err
-	}
-
-	var strongText string
-	var extract func(*html.Node)
-	extract = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "strong" {
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				if c.Type == html.TextNode {
-					strongText = strings.TrimSpace(c.Data)
-					return
-				}
-			}
-		}
-
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			extract(c)
-		}
+		return filepath.Base(rawURL)
 	}
-	extract(doc)
-	return strongText, nil
+	return path.Base(u.Path)
 }
 
-// Links returns a map of href to text within <a> tags
-// Returns: {https://cetatenie.just.ro/wp-content/uploads/2022/01/Ordin-1795-P-26.10.2023-art-11.pdf:1795P
-// https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1796-P-26.10.2023-art-11.pdf:1796P
-// https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1797-din-26.10.2023-art-11.pdf:1797P}
-func Links(htmlString string) (map[string]string, error) {
-	links := make(map[string]string)
-
-	doc, err := html.Parse(strings.NewReader(htmlString))
-	if err != nil {
-		return nil, err
-	}
-
-	var extract func(*html.Node)
-	extract = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			href := ""
-			text := ""
-
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					href = attr.Val
-					break
-				}
-			}
-
-			for c := n.FirstChild; c != nil; c = c.NextSibling {
-				if c.Type == html.TextNode {
-					text += c.Data
-				}
-			}
-
-			text = strings.TrimSpace(text)
-
-			if href != "" && text != "" {
-				links[href] = text
-			}
-		}
-
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			extract(c)
-		}
-	}
-
-	extract(doc)
-	return links, nil
-}
-
-// OrderFiles returns a slice of model.OrderFile from a slice of strings, sorted from 2018 to 202*+.
+// OrderFiles returns a slice of model.OrderFile from listing entries, sorted from 2018 to 202*+.
+// The site lists the newest orders first, so entries are reversed item by item while links inside an item keep their order.
 // Returns: {26.10.2023 https://cetatenie.just.ro/wp-content/uploads/2022/01/Ordin-1795-P-26.10.2023-art-11.pdf 1795P}
 // {26.10.2023 https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1796-P-26.10.2023-art-11.pdf 1796P}
 // {26.10.2023 https://cetatenie.just.ro/wp-content/uploads/2022/01/ordin-1797-din-26.10.2023-art-11.pdf 1797P}
-func OrderFiles(s []string) ([]model.OrderFile, error) {
-	var result []model.OrderFile
-
-	for i := len(s) - 1; i >= 0; i-- { // _, el := range s { //without sorting
-		el := s[i] // doesn`t need without sorting
-		strongText, err := StrongText(el)
-		if err != nil {
-			fmt.Printf("Error: %e\n", err)
-			continue
+func OrderFiles(entries []ListingEntry) []model.OrderFile {
+	result := make([]model.OrderFile, 0, len(entries))
+
+	for i := len(entries) - 1; i >= 0; {
+		// Find the first entry of the current <li>
+		j := i
+		for j > 0 && entries[j-1].Position == entries[i].Position {
+			j--
 		}
-
-		links, err := Links(el)
-		if err != nil {
-			fmt.Printf("Error: %e\n", err)
-		}
-
-		for link, name := range links {
-			order := model.OrderFile{
-				Date:     strongText,
-				URL:      link,
-				Filename: filepath.Base(link),
-				Name:     name,
-			}
-			result = append(result, order)
+		for _, el := range entries[j : i+1] {
+			// Unparseable dates and names stay zero and are listed for review later
+			orderDate, _ := ParseDate(el.Date)
+			orderName, _ := ParseOrderName(el.Name)
+			result = append(result, model.OrderFile{
+				Date:        el.Date,
+				OrderDate:   orderDate,
+				URL:         el.URL,
+				Filename:    Filename(el.URL),
+				Name:        el.Name,
+				OrderNumber: orderName.Number,
+				OrderSeries: orderName.Series,
+			})
 		}
+		i = j - 1
 	}
 
-	return result, nil
+	return result
 }
 
-// Parse the pdf file and return the list of orders
+// Parse the pdf files and return the list of orders.
+// Files which can't be parsed are skipped and returned as a *pipeline.Errors along with the orders of the others.
 func Order(path string, orderFiles ...string) ([]model.Order, error) {
 	// tager storage for data
 	orders := make([]model.Order, 0, len(orderFiles))
+	var failed pipeline.Errors
 
 	for _, filename := range orderFiles {
-		ordersFromPDF, err := orderFromPDF(path, filename)
+		ordersFromPDF, _, err := Parse(path, filename)
 		if err != nil {
-			fmt.Printf("error in orderFromPDf:%s\t%e\t", filename, err)
+			failed.Add(pipeline.FileError(filename, err))
 			continue
 		}
 		orders = append(orders, ordersFromPDF...)
 	}
 
-	return orders, nil
+	return orders, failed.Err()
 }
 
-// Parse the pdf file and return the list of orders
-func orderFromPDF(path string, filename string) ([]model.Order, error) {
-	orders := make([]model.Order, 0)
+// Parse extracts the dossiers and the plain text of every page of a PDF file.
+// Pages are in document order, so page N is pages[N-1].
+func Parse(path string, filename string) ([]model.Order, []string, error) {
+	start := time.Now()
+	pages, err := pdfPages(path, filename)
+	if err != nil {
+		parseDuration.Observe(time.Since(start).Seconds(), "error")
+		return nil, nil, err
+	}
+	orders := ordersFromText(filename, strings.Join(pages, ""))
+	parseDuration.Observe(time.Since(start).Seconds(), "ok")
+	dossiersExtracted.Add(float64(len(orders)))
+	return orders, pages, nil
+}
 
+// pdfPages returns the plain text of every page of a PDF file
+func pdfPages(path string, filename string) ([]string, error) {
 	// Open the PDF file
-	file, pdfReader, err := pdf.Open(path + filename)
+	file, pdfReader, err := pdf.Open(filepath.Join(path, filename))
 	if err != nil {
-		fmt.Printf("error in openning PDF-file: %s\n%e\n", filename, err)
-		file.Close()
-		return nil, err
+		return nil, fmt.Errorf("error opening PDF file %s: %w", filename, err)
 	}
 	defer file.Close()
 
-	// Extract the text from the PDF
-	text, err := pdfReader.GetPlainText()
-	if err != nil {
-		fmt.Printf("error in extracting file data: %s\n%e\n", filename, err)
-		file.Close()
-		return nil, err
+	// Extract the text page by page; fonts are cached so their charmaps are parsed once per file
+	pages := make([]string, 0, pdfReader.NumPage())
+	fonts := make(map[string]*pdf.Font)
+	for i := 1; i <= pdfReader.NumPage(); i++ {
+		page := pdfReader.Page(i)
+		for _, name := range page.Fonts() {
+			if _, ok := fonts[name]; !ok {
+				font := page.Font(name)
+				fonts[name] = &font
+			}
+		}
+		text, err := page.GetPlainText(fonts)
+		if err != nil {
+			return nil, fmt.Errorf("error extracting text from %s, page %d: %w", filename, i, err)
+		}
+		pages = append(pages, text)
 	}
 
-	data, _ := io.ReadAll(text)
-	data2 := string(data)
+	slog.Debug("PDF text extracted", "file", filename, "pages", len(pages))
+	return pages, nil
+}
 
-	// Extract the digits using a regular expression
-	fmt.Printf("String: %s\n", data2)
+// ordersFromText returns the dossiers found in the text of a PDF file
+func ordersFromText(filename string, text string) []model.Order {
+	orders := make([]model.Order, 0)
 
+	// Extract the digits using a regular expression
 	//re := regexp.MustCompile(`(\d+\/\d{4})`)
 	re := regexp.MustCompile(`(\d+\/[A-Za-z]{0,2}\/\d{4}|\d+\/\d{4})`)
 
-	digits := re.FindAllString(data2, -1)
-	fmt.Printf("digits: %v\t\n", digits)
+	digits := re.FindAllString(text, -1)
+	slog.Debug("Dossier numbers found", "file", filename, "count", len(digits))
 	for _, digit := range digits {
 		o, err := orderFromLine(digit)
 		if err != nil {
-			// return nil, err
+			slog.Debug("Dossier number skipped", "file", filename, "text", digit, "error", err)
 			continue
 		}
 		order := model.Order{
@@ -219,11 +156,12 @@ func orderFromPDF(path string, filename string) ([]model.Order, error) {
 			Year:              o.Year,
 			Number:            o.Number,
 			FullNameFormatted: o.FullNameFormatted,
+			Category:          o.Category,
 		}
 		orders = append(orders, order)
 	}
 
-	return orders, nil
+	return orders
 }
 
 // orderFromLine extracts an order and year from a single line, returning a local struct
@@ -252,11 +190,9 @@ func orderFromLine(s string) (orderLocal, error) {
 	checkAndExtractYear := func(str string) (uint, error) {
 		n, err := strconv.ParseUint(str, 10, 32)
 		if err != nil {
-			log.Printf("error extracting year from line: %s\t%e\t", str, err)
 			return 0, fmt.Errorf("error extracting year from line: %s\t%w\t", str, err)
 		}
 		if n < 2010 || n > 2050 {
-			log.Printf("error extracting year from line: %s\tinvalid year\t", str)
 			return 0, fmt.Errorf("error extracting year from line: %s\tinvalid year\t", str)
 		}
 		return uint(n), nil
@@ -274,14 +210,25 @@ func orderFromLine(s string) (orderLocal, error) {
 		return orderLocal{}, err
 	}
 
-	// Format the full name using the extracted number and year
+	// Category letters between number and year, e.g. RD in 12345/RD/2019
+	category := ""
+	if numParts == 3 {
+		category = strings.ToUpper(parts[1])
+	}
+
+	// Format the full name using the extracted number, category and year; dossiers of different categories
+	// can have the same number and year
 	fullName := strconv.Itoa(int(number)) + "/" + strconv.Itoa(int(year))
+	if category != "" {
+		fullName = strconv.Itoa(int(number)) + "/" + category + "/" + strconv.Itoa(int(year))
+	}
 
 	// Create and return the order local struct
 	order := orderLocal{
 		Number:            number,
 		Year:              year,
 		FullNameFormatted: fullName,
+		Category:          category,
 	}
 
 	return order, nil
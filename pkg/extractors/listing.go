@@ -0,0 +1,230 @@
+package extractors
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ListingEntry is a single order link found on a listing page.
+// Example: {Date: "26.10.2023", Name: "1795P", URL: "https://cetatenie.just.ro/wp-content/uploads/2022/01/Ordin-1795-P-26.10.2023-art-11.pdf", Position: 3}
+type ListingEntry struct {
+	Date     string `json:"date"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`      // absolute, resolved against the listing page URL
+	Position int    `json:"position"` // 1-based position of the <li> on the page
+}
+
+// ListingIssue describes a listing item that looks like an order entry but could not be understood.
+type ListingIssue struct {
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+	Reason   string `json:"reason"`
+}
+
+// Listing is the result of parsing a listing page.
+type Listing struct {
+	Entries []ListingEntry `json:"entries"`
+	Issues  []ListingIssue `json:"issues"`
+}
+
+// ParseListing parses a listing page and returns its order entries in page order.
+// Items that link to PDF files or carry an emphasized date are treated as order items,
+// everything else (menus, footers) is ignored. Order items that can't be understood are
+// reported in Listing.Issues instead of being dropped. Links are resolved against base,
+// the URL of the page.
+func ParseListing(r io.Reader, base *url.URL) (Listing, error) {
+	var listing Listing
+
+	doc, err := html.Parse(r)
+	if err != nil {
+		return listing, fmt.Errorf("error parsing listing page: %w", err)
+	}
+
+	// Collect <li> nodes in document order
+	position := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Li {
+			position++
+			parseListItem(n, base, position, &listing)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	listingEntries.Add(float64(len(listing.Entries)), "entry")
+	listingEntries.Add(float64(len(listing.Issues)), "issue")
+
+	return listing, nil
+}
+
+// parseListItem extracts entries from a single <li> node and appends them (or issues) to the listing
+func parseListItem(li *html.Node, base *url.URL, position int, listing *Listing) {
+	date, hasDate := emphasizedText(li)
+	links := anchors(li, base)
+
+	// Count links that point to order files
+	pdfLinks := 0
+	for _, a := range links {
+		if isPDF(a.href) {
+			pdfLinks++
+		}
+	}
+
+	// Not an order item: navigation, footer, etc.
+	if !hasDate && pdfLinks == 0 {
+		return
+	}
+
+	issue := func(reason string) {
+		listing.Issues = append(listing.Issues, ListingIssue{
+			Position: position,
+			Text:     collapseSpaces(nodeText(li)),
+			Reason:   reason,
+		})
+	}
+
+	if date == "" {
+		issue("missing date")
+		return
+	}
+	if pdfLinks == 0 {
+		issue("no order links")
+		return
+	}
+
+	for _, a := range links {
+		switch {
+		case !isPDF(a.href):
+			// Links to other pages inside an order item are not orders
+			continue
+		case a.url == nil:
+			issue(fmt.Sprintf("invalid link %s", a.href))
+			continue
+		case a.text == "":
+			issue(fmt.Sprintf("empty link text for %s", a.href))
+			continue
+		}
+		listing.Entries = append(listing.Entries, ListingEntry{
+			Date:     date,
+			Name:     a.text,
+			URL:      a.url.String(),
+			Position: position,
+		})
+	}
+}
+
+type anchor struct {
+	href string
+	url  *url.URL // href resolved against the page URL, nil if href isn't a valid URL
+	text string
+}
+
+// anchors returns all <a> elements below n in document order
+func anchors(n *html.Node, base *url.URL) []anchor {
+	var result []anchor
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.A {
+			href := ""
+			for _, attr := range n.Attr {
+				if attr.Key == "href" {
+					href = strings.TrimSpace(attr.Val)
+					break
+				}
+			}
+			a := anchor{href: href, text: collapseSpaces(nodeText(n))}
+			if u, err := url.Parse(href); err == nil {
+				a.url = base.ResolveReference(u)
+			}
+			result = append(result, a)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return result
+}
+
+// emphasizedText returns the text of the first <strong> or <b> element below n
+func emphasizedText(n *html.Node) (string, bool) {
+	if n.Type == html.ElementNode && (n.DataAtom == atom.Strong || n.DataAtom == atom.B) {
+		return collapseSpaces(nodeText(n)), true
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if text, ok := emphasizedText(c); ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// nodeText returns the concatenated text content of n and its descendants
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+	}
+	return sb.String()
+}
+
+// collapseSpaces trims s and replaces runs of whitespace (including &nbsp;) with a single space
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// isPDF reports whether href points to a PDF file
+func isPDF(href string) bool {
+	if href == "" {
+		return false
+	}
+	// Ignore query and fragment
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	return strings.EqualFold(path.Ext(href), ".pdf")
+}
+
+// DiffListings compares two listings by order URL and returns entries which appear only in next (added),
+// entries which appear only in prev (removed) and entries of next whose date or name differ in prev (changed).
+// A moved entry isn't changed, positions shift whenever an order is added above it.
+func DiffListings(prev, next Listing) (added, removed, changed []ListingEntry) {
+	prevEntries := make(map[string]ListingEntry, len(prev.Entries))
+	for _, el := range prev.Entries {
+		prevEntries[el.URL] = el
+	}
+	nextURLs := make(map[string]bool, len(next.Entries))
+	for _, el := range next.Entries {
+		nextURLs[el.URL] = true
+	}
+
+	for _, el := range next.Entries {
+		old, ok := prevEntries[el.URL]
+		switch {
+		case !ok:
+			added = append(added, el)
+		case old.Date != el.Date || old.Name != el.Name:
+			changed = append(changed, el)
+		}
+	}
+	for _, el := range prev.Entries {
+		if !nextURLs[el.URL] {
+			removed = append(removed, el)
+		}
+	}
+
+	return added, removed, changed
+}
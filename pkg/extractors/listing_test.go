@@ -0,0 +1,167 @@
+package extractors
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseListing(t *testing.T) {
+	base, _ := url.Parse("https://cetatenie.just.ro/ordine-articolul-1-1/")
+	tests := []struct {
+		name    string
+		html    string
+		entries []ListingEntry
+		issues  []ListingIssue
+	}{
+		{
+			name: "order item with several links",
+			html: `<ul><li><strong>26.10.2023</strong> <a href="/o/Ordin-1795-P.pdf">1795P</a>, <a href="/o/Ordin-1796-P.PDF?x=1"> 1796&nbsp;P </a></li></ul>`,
+			entries: []ListingEntry{
+				{Date: "26.10.2023", Name: "1795P", URL: "https://cetatenie.just.ro/o/Ordin-1795-P.pdf", Position: 1},
+				{Date: "26.10.2023", Name: "1796 P", URL: "https://cetatenie.just.ro/o/Ordin-1796-P.PDF?x=1", Position: 1},
+			},
+		},
+		{
+			name: "navigation items are ignored",
+			html: `<ul><li><a href="/">Home</a></li><li><b>2.11.2023</b> <a href="/o/1.pdf">1P</a> <a href="/page">more</a></li></ul>`,
+			entries: []ListingEntry{
+				{Date: "2.11.2023", Name: "1P", URL: "https://cetatenie.just.ro/o/1.pdf", Position: 2},
+			},
+		},
+		{
+			name:   "order link without date",
+			html:   `<ul><li><a href="/o/1.pdf">1P</a></li></ul>`,
+			issues: []ListingIssue{{Position: 1, Text: "1P", Reason: "missing date"}},
+		},
+		{
+			name:   "date without order links",
+			html:   `<ul><li><strong>26.10.2023</strong> no orders</li></ul>`,
+			issues: []ListingIssue{{Position: 1, Text: "26.10.2023 no orders", Reason: "no order links"}},
+		},
+		{
+			name:   "empty link text",
+			html:   `<ul><li><strong>26.10.2023</strong> <a href="/o/1.pdf"> </a></li></ul>`,
+			issues: []ListingIssue{{Position: 1, Text: "26.10.2023", Reason: "empty link text for /o/1.pdf"}},
+		},
+		{
+			name: "links are resolved against the page URL",
+			html: `<ul><li><strong>26.10.2023</strong> <a href="1.pdf">1P</a> <a href="../o/2.pdf#p=2">2P</a> <a href="//cdn.just.ro/3.pdf">3P</a> <a href="http://other.ro/4.pdf">4P</a></li></ul>`,
+			entries: []ListingEntry{
+				{Date: "26.10.2023", Name: "1P", URL: "https://cetatenie.just.ro/ordine-articolul-1-1/1.pdf", Position: 1},
+				{Date: "26.10.2023", Name: "2P", URL: "https://cetatenie.just.ro/o/2.pdf#p=2", Position: 1},
+				{Date: "26.10.2023", Name: "3P", URL: "https://cdn.just.ro/3.pdf", Position: 1},
+				{Date: "26.10.2023", Name: "4P", URL: "http://other.ro/4.pdf", Position: 1},
+			},
+		},
+		{
+			name:   "invalid link",
+			html:   `<ul><li><strong>26.10.2023</strong> <a href="/o/%zz.pdf">1P</a></li></ul>`,
+			issues: []ListingIssue{{Position: 1, Text: "26.10.2023 1P", Reason: "invalid link /o/%zz.pdf"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listing, err := ParseListing(strings.NewReader(tt.html), base)
+			if err != nil {
+				t.Fatalf("ParseListing: %v", err)
+			}
+			if !reflect.DeepEqual(listing.Entries, tt.entries) {
+				t.Errorf("entries = %+v, want %+v", listing.Entries, tt.entries)
+			}
+			if !reflect.DeepEqual(listing.Issues, tt.issues) {
+				t.Errorf("issues = %+v, want %+v", listing.Issues, tt.issues)
+			}
+		})
+	}
+}
+
+func TestFilename(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{url: "https://cetatenie.just.ro/wp-content/uploads/Ordin-1795-P.pdf", want: "Ordin-1795-P.pdf"},
+		{url: "https://cetatenie.just.ro/o/Ordin-1796-P.PDF?x=1", want: "Ordin-1796-P.PDF"},
+		{url: "https://cetatenie.just.ro/o/2.pdf#p=2", want: "2.pdf"},
+		{url: "https://cetatenie.just.ro/o/Ordin%201797.pdf?ver=2&x=a/b", want: "Ordin 1797.pdf"},
+	}
+	for _, tt := range tests {
+		if got := Filename(tt.url); got != tt.want {
+			t.Errorf("Filename(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+	files := OrderFiles([]ListingEntry{{Date: "26.10.2023", Name: "1796P", URL: tests[1].url}})
+	if len(files) != 1 || files[0].Filename != "Ordin-1796-P.PDF" || files[0].URL != tests[1].url {
+		t.Errorf("OrderFiles = %+v, want Ordin-1796-P.PDF linking to %s", files, tests[1].url)
+	}
+}
+
+func TestDiffListings(t *testing.T) {
+	a := ListingEntry{Date: "26.10.2023", Name: "1795P", URL: "/o/1795.pdf", Position: 1}
+	b := ListingEntry{Date: "26.10.2023", Name: "1796P", URL: "/o/1796.pdf", Position: 1}
+	c := ListingEntry{Date: "2.11.2023", Name: "1P", URL: "/o/1.pdf", Position: 2}
+	moved := c
+	moved.Position = 3
+	renamed := b
+	renamed.Name = "1796 P"
+	redated := a
+	redated.Date = "27.10.2023"
+
+	tests := []struct {
+		name                    string
+		prev, next              []ListingEntry
+		added, removed, changed []ListingEntry
+	}{
+		{
+			name: "empty listings",
+		},
+		{
+			name: "same entries",
+			prev: []ListingEntry{a, b, c},
+			next: []ListingEntry{a, b, c},
+		},
+		{
+			name:  "first listing",
+			next:  []ListingEntry{a, b},
+			added: []ListingEntry{a, b},
+		},
+		{
+			name:    "added and removed",
+			prev:    []ListingEntry{a, b},
+			next:    []ListingEntry{b, c},
+			added:   []ListingEntry{c},
+			removed: []ListingEntry{a},
+		},
+		{
+			name: "moved entry",
+			prev: []ListingEntry{a, c},
+			next: []ListingEntry{a, moved},
+		},
+		{
+			name:    "changed name and date",
+			prev:    []ListingEntry{a, b, c},
+			next:    []ListingEntry{redated, renamed, c},
+			changed: []ListingEntry{redated, renamed},
+		},
+		{
+			name:    "all removed",
+			prev:    []ListingEntry{a, b},
+			removed: []ListingEntry{a, b},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, changed := DiffListings(Listing{Entries: tt.prev}, Listing{Entries: tt.next})
+			if !reflect.DeepEqual(added, tt.added) {
+				t.Errorf("added = %+v, want %+v", added, tt.added)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Errorf("removed = %+v, want %+v", removed, tt.removed)
+			}
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed = %+v, want %+v", changed, tt.changed)
+			}
+		})
+	}
+}
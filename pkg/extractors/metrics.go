@@ -0,0 +1,12 @@
+package extractors
+
+import "romaniabot/pkg/metrics"
+
+var (
+	parseDuration = metrics.NewHistogram("romaniabot_parse_duration_seconds",
+		"Time to extract dossiers from a single order file, by result.", nil, "result")
+	dossiersExtracted = metrics.NewCounter("romaniabot_dossiers_extracted_total",
+		"Dossier numbers extracted from order files.")
+	listingEntries = metrics.NewCounter("romaniabot_listing_entries_total",
+		"Listing items parsed, by result (\"entry\" for order links, \"issue\" for items which could not be understood).", "result")
+)
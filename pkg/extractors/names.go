@@ -0,0 +1,41 @@
+package extractors
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OrderName is the parsed form of an order link text such as "1795P"
+type OrderName struct {
+	Number uint   `json:"number"`
+	Series string `json:"series"`
+}
+
+var (
+	// Leading words which sometimes precede the number: "nr. 1795P", "Ordin 1795P", "ordinul nr 1795P"
+	reNamePrefix = regexp.MustCompile(`^(?:ordin(?:ul)?\.?\s*)?(?:nr\.?\s*)?`)
+	// 1795P, 1795 P, 1795/P, 1795-P, 1795, 1795P/2023, 1795/P/2023
+	reOrderName = regexp.MustCompile(`^(\d+)\s*[/\-]?\s*([a-z]{0,3})(?:\s*[/\-]\s*(?:\d{4}|\d{2}))?$`)
+)
+
+// ParseOrderName parses the anchor text of an order link into a numeric order number and a series suffix.
+// Example: "1795P" -> {1795 "P"}, "1795 / p" -> {1795 "P"}, "1796" -> {1796 ""}
+func ParseOrderName(raw string) (OrderName, error) {
+	s := strings.ToLower(collapseSpaces(raw))
+	s = strings.TrimRight(s, ".,; ")
+	s = reNamePrefix.ReplaceAllString(s, "")
+
+	m := reOrderName.FindStringSubmatch(s)
+	if m == nil {
+		return OrderName{}, fmt.Errorf("error parsing order name %q: unknown format", raw)
+	}
+
+	number, err := strconv.ParseUint(m[1], 10, 32)
+	if err != nil {
+		return OrderName{}, fmt.Errorf("error parsing order name %q: %w", raw, err)
+	}
+
+	return OrderName{Number: uint(number), Series: strings.ToUpper(m[2])}, nil
+}
@@ -0,0 +1,37 @@
+package extractors
+
+import "testing"
+
+func TestParseOrderName(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    OrderName
+		wantErr bool
+	}{
+		{raw: "1795P", want: OrderName{1795, "P"}},
+		{raw: "1795 P", want: OrderName{1795, "P"}},
+		{raw: "1795 / p", want: OrderName{1795, "P"}},
+		{raw: "1795-P", want: OrderName{1795, "P"}},
+		{raw: "1796", want: OrderName{1796, ""}},
+		{raw: "1795P/2023", want: OrderName{1795, "P"}},
+		{raw: "1795/P/23", want: OrderName{1795, "P"}},
+		{raw: "nr. 1795P", want: OrderName{1795, "P"}},
+		{raw: "Ordinul nr 1795 RD.", want: OrderName{1795, "RD"}},
+		{raw: "", wantErr: true},
+		{raw: "P1795", wantErr: true},
+		{raw: "1795 ABCD", wantErr: true},
+		{raw: "99999999999", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseOrderName(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseOrderName(%q) = %+v, want an error", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseOrderName(%q) = %+v, %v, want %+v", tt.raw, got, err, tt.want)
+		}
+	}
+}
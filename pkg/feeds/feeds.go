@@ -0,0 +1,160 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Feed is a format-independent feed
+type Feed struct {
+	Title   string
+	Link    string // HTML page of the feed
+	SelfURL string // URL of the feed itself
+	Updated time.Time
+	Items   []Item
+}
+
+// Item is a single feed entry
+type Item struct {
+	ID        string
+	Title     string
+	Link      string
+	Summary   string
+	Category  string
+	Published time.Time
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string        `xml:"id"`
+	Title     string        `xml:"title"`
+	Updated   string        `xml:"updated"`
+	Published string        `xml:"published"`
+	Link      atomLink      `xml:"link"`
+	Summary   string        `xml:"summary"`
+	Category  *atomCategory `xml:"category,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Atom renders the feed as Atom 1.0
+func Atom(f Feed) ([]byte, error) {
+	feed := atomFeed{
+		ID:      f.SelfURL,
+		Title:   f.Title,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.SelfURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate"},
+		},
+		Entries: make([]atomEntry, 0, len(f.Items)),
+	}
+
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Updated:   item.Published.UTC().Format(time.RFC3339),
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Link:      atomLink{Href: item.Link, Rel: "alternate", Type: "application/pdf"},
+			Summary:   item.Summary,
+		}
+		if item.Category != "" {
+			entry.Category = &atomCategory{Term: item.Category}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return marshal(feed)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          rssSelf   `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// RSS renders the feed as RSS 2.0
+func RSS(f Feed) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Title,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+			Self:          rssSelf{Href: f.SelfURL, Rel: "self", Type: "application/rss+xml"},
+			Items:         make([]rssItem, 0, len(f.Items)),
+		},
+	}
+
+	for _, item := range f.Items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Summary,
+			Category:    item.Category,
+			GUID:        rssGUID{Value: item.ID, IsPermaLink: item.ID == item.Link},
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+
+	return marshal(feed)
+}
+
+// marshal encodes v as an indented XML document
+func marshal(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding feed: %w", err)
+	}
+	return append([]byte(xml.Header), body...), nil
+}
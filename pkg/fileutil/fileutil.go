@@ -2,11 +2,15 @@ package fileutil
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime"
 	"os"
+	"path/filepath"
 )
 
 // WriteToFileStrings writes lines to a new file or overwrites an existing file
@@ -102,33 +106,35 @@ func ReadBytesfromFile(filename string) ([]byte, error) {
 }
 
 // CheckDir checks if a directory exists at the given path, and creates it if it doesn't.
-// Returns true if the directory exists or was successfully created.
-func CheckDir(path string) bool {
+// Returns an error if the directory doesn't exist and can't be created.
+func CheckDir(path string) error {
 	// Check if the path is not empty
 	if len(path) > 0 {
 		// Create the directory with the given path and permissions 0750
 		err := os.Mkdir(path, 0750)
 		// Check if there was an error creating the directory and it's not because the directory already exists
 		if err != nil && !os.IsExist(err) {
-			// Handle the error by calling ErrChecking function
-			ErrChecking(err)
+			return fmt.Errorf("error creating directory %s: %w", path, err)
 		}
 	}
-	// Return true to indicate that the directory exists or was successfully created
-	return true
+	return nil
 }
 
-func GetFileListInFolder(path string) []string{
+// GetFileListInFolder returns the names of the entries of a directory; a missing directory has none
+func GetFileListInFolder(path string) ([]string, error) {
 	files, err := os.ReadDir(path)
-	var filesInDir []string
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("error reading directory %s: %w", path, err)
 	}
 
+	var filesInDir []string
 	for _, file := range files {
 		filesInDir = append(filesInDir, file.Name())
 	}
-	return filesInDir
+	return filesInDir, nil
 }
 
 // CheckFile checks if a file exists and returns true if it does, false otherwise.
@@ -137,36 +143,31 @@ func CheckFile(fname string) bool {
 	return err == nil
 }
 
-// Сохранение в файл байтовой информацией. Файл создается с нуля, не дополняется
+// Сохранение в файл байтовой информацией. Файл создается с нуля, не дополняется.
+// The bytes are written to a temporary file in the same folder which is then renamed into place,
+// so readers never see a half-written file.
 func WriteToFile(pathForSave, filename string, b []byte) error {
-	options := os.O_WRONLY | os.O_CREATE
-	mode := int(0777)
-	file, err := os.OpenFile(pathForSave+filename, options, os.FileMode(mode))
+	tmp, err := os.CreateTemp(pathForSave, "."+filename+"-*")
 	if err != nil {
 		return err
 	}
-	_, err = file.Write(b)
-	if err != nil {
-		return err
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
 	}
-	err = file.Close()
-	if err != nil {
-		return err
+	// Temporary files are private, order files are read by other tools
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
 	}
-	fmt.Printf("File %s saved.\n", filename)
-	return nil
-}
-
-// The ErrChecking function is used to check if an error occurred.
-// If an error is present, it prints "oops" and exits the program with the error message.
-func ErrChecking(err error) {
-	// Check if an error occurred
 	if err != nil {
-		// Print "oops" to indicate an error
-		fmt.Println("oops")
-		// Exit the program with the error message
-		log.Fatal(err)
+		return err
 	}
+	return os.Rename(tmp.Name(), filepath.Join(pathForSave, filename))
 }
 
 // IsExtension checks if the given file has the specified extension.
@@ -174,7 +175,6 @@ func IsExtension(fname string, ext string) bool {
 	// Open the file with the given filename.
 	file, err := os.Open(fname)
 	if err != nil {
-		log.Println(err)
 		return false
 	}
 	defer file.Close()
@@ -185,3 +185,63 @@ func IsExtension(fname string, ext string) bool {
 	// Check if the MIME type matches the provided extension.
 	return mimeType == ext
 }
+
+// HashFile returns the hex SHA-256 and the size of a file
+func HashFile(fname string) (string, int64, error) {
+	file, err := os.Open(fname)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("error reading file %s: %w", fname, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// Errors returned by CheckPDF
+var (
+	ErrEmptyFile = errors.New("file is empty")
+	ErrNotPDF    = errors.New("no PDF header")
+	ErrTruncated = errors.New("no PDF end-of-file marker, file is truncated")
+)
+
+// pdfMarkerWindow is how far from the start and the end of a file the PDF markers are looked for
+const pdfMarkerWindow = 1024
+
+// CheckPDF checks that a file looks like a complete PDF: a %PDF- header near the start and a %%EOF marker near the end
+func CheckPDF(fname string) error {
+	file, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return ErrEmptyFile
+	}
+
+	head := make([]byte, min(pdfMarkerWindow, info.Size()))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return fmt.Errorf("error reading file %s: %w", fname, err)
+	}
+	if !bytes.Contains(head, []byte("%PDF-")) {
+		return ErrNotPDF
+	}
+
+	tail := make([]byte, min(pdfMarkerWindow, info.Size()))
+	if _, err := file.ReadAt(tail, info.Size()-int64(len(tail))); err != nil && err != io.EOF {
+		return fmt.Errorf("error reading file %s: %w", fname, err)
+	}
+	if !bytes.Contains(tail, []byte("%%EOF")) {
+		return ErrTruncated
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteToFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, content := range []string{"%PDF-1.4 first version %%EOF", "%PDF-1.4 second %%EOF"} {
+		if err := WriteToFile(dir, "order.pdf", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(filepath.Join(dir, "order.pdf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("order.pdf = %q, want %q", got, content)
+		}
+	}
+
+	// Only the order file is left, no temporary files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("folder has %d entries, want 1", len(entries))
+	}
+
+	if err := WriteToFile(filepath.Join(dir, "missing"), "order.pdf", nil); err == nil {
+		t.Error("writing to a missing folder succeeded")
+	}
+}
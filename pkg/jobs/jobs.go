@@ -0,0 +1,302 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/metrics"
+)
+
+// Job kinds
+const (
+	KindDownload = "download"
+	KindParse    = "parse"
+)
+
+// Kinds lists all job kinds in pipeline order
+var Kinds = []string{KindDownload, KindParse}
+
+// Job statuses
+const (
+	StatusPending = "pending"
+	StatusLeased  = "leased"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+// Queue settings, replaced from the config at startup
+var (
+	// VisibilityTimeout is the lease of a claimed job; a job whose lease expires is claimed again by any worker
+	VisibilityTimeout = 5 * time.Minute
+	// MaxAttempts is the number of attempts before a job is dead-lettered
+	MaxAttempts = 5
+	// Backoff is the delay after the first failed attempt, doubled after each next one up to maxBackoff
+	Backoff = time.Minute
+)
+
+// maxBackoff caps the delay between attempts, so a job with many attempts is still retried daily
+const maxBackoff = 24 * time.Hour
+
+// ErrLeaseLost is returned when a job's lease expired and another worker may have claimed it
+var ErrLeaseLost = errors.New("job lease lost")
+
+var jobsTotal = metrics.NewCounter("romaniabot_jobs_total",
+	"Finished job attempts by kind and result (done, retry: failed and scheduled again, dead: dead-lettered).", "kind", "result")
+
+// enqueueQueries selects the order files waiting for each kind of job
+var enqueueQueries = map[string]string{
+	KindDownload: model.Enqueue_Download_Jobs,
+	KindParse:    model.Enqueue_Parse_Jobs,
+}
+
+// Handler does the work of one kind of job
+type Handler struct {
+	// Handle processes a claimed job; an error fails the attempt
+	Handle func(ctx context.Context, job model.Job) error
+	// Failed is called once a failed attempt is recorded; dead is true if the job won't be retried
+	Failed func(ctx context.Context, job model.Job, err error, dead bool)
+}
+
+// Result counts the job attempts of a Work call
+type Result struct {
+	Done  int
+	Retry int
+	Dead  int
+}
+
+// Owner returns the lease owner name of this process
+func Owner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Enqueue adds a job of kind for every order file waiting for it which has no active or dead-lettered job.
+// Returns the number of new jobs.
+func Enqueue(ctx context.Context, db *sql.DB, kind string) (int, error) {
+	query, ok := enqueueQueries[kind]
+	if !ok {
+		return 0, fmt.Errorf("unknown job kind %q", kind)
+	}
+	res, err := db.ExecContext(ctx, query, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error enqueueing %s jobs: %w", kind, err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// Requeue adds a job of kind for filename right away, whatever jobs the file had before.
+// Does nothing if the file already has an active job of kind.
+func Requeue(ctx context.Context, db *sql.DB, kind, filename string) error {
+	if _, ok := enqueueQueries[kind]; !ok {
+		return fmt.Errorf("unknown job kind %q", kind)
+	}
+	if _, err := db.ExecContext(ctx, model.Insert_Job, kind, filename, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error queueing %s job for %s: %w", kind, filename, err)
+	}
+	return nil
+}
+
+// Work claims due jobs of kind one by one and runs them with h until none is due or ctx is cancelled.
+// The lease of a running job is renewed, so only a stopped worker loses it.
+// Failed attempts are retried after an exponential backoff until MaxAttempts is reached, then dead-lettered.
+// Returns an error only if the queue itself can't be used.
+func Work(ctx context.Context, db *sql.DB, kind, owner string, h Handler) (Result, error) {
+	var result Result
+	// Results of finished attempts are recorded even if ctx is cancelled meanwhile
+	recordCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		// Jobs of crashed workers which used their last attempt aren't claimed again
+		expired, err := queryJobs(ctx, db, model.Dead_letter_expired_Jobs, time.Now().UTC(), kind, MaxAttempts)
+		if err != nil {
+			return result, err
+		}
+		for _, job := range expired {
+			slog.WarnContext(ctx, "Job dead-lettered", "job", job.ID, "kind", kind, "file", job.Filename, "error", job.LastError)
+			jobsTotal.Inc(kind, "dead")
+			result.Dead++
+			h.Failed(ctx, job, errors.New(job.LastError), true)
+		}
+
+		job, err := claim(ctx, db, kind, owner)
+		if err != nil {
+			return result, err
+		}
+		if job == nil {
+			return result, nil
+		}
+
+		handleErr := run(ctx, db, *job, owner, h.Handle)
+		if handleErr == nil {
+			err = complete(recordCtx, db, *job, owner)
+			if err == nil {
+				jobsTotal.Inc(kind, StatusDone)
+				result.Done++
+				continue
+			}
+			if !errors.Is(err, ErrLeaseLost) {
+				return result, err
+			}
+			// Another worker owns the job now and does it again
+			slog.WarnContext(ctx, "Job lease lost before completion", "job", job.ID, "kind", kind, "file", job.Filename)
+			continue
+		}
+
+		// An interrupted attempt is not the job's fault, the job is given back to the queue
+		if ctx.Err() != nil {
+			release(db, *job, owner)
+			return result, nil
+		}
+
+		dead, err := fail(recordCtx, db, *job, owner, handleErr)
+		if errors.Is(err, ErrLeaseLost) {
+			slog.WarnContext(ctx, "Job lease lost before failure was recorded", "job", job.ID, "kind", kind, "file", job.Filename)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if dead {
+			jobsTotal.Inc(kind, "dead")
+			result.Dead++
+		} else {
+			jobsTotal.Inc(kind, "retry")
+			result.Retry++
+		}
+		h.Failed(recordCtx, *job, handleErr, dead)
+	}
+	return result, nil
+}
+
+// Retry resets a dead-lettered job to pending with fresh attempts
+func Retry(ctx context.Context, db *sql.DB, id int64) error {
+	res, err := db.ExecContext(ctx, model.Set_Job_pending, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("error resetting job %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("dead-lettered job %d not found", id)
+	}
+	return nil
+}
+
+// List returns the latest jobs with status, newest first; an empty status lists all jobs
+func List(ctx context.Context, db *sql.DB, status string, limit int) ([]model.Job, error) {
+	return queryJobs(ctx, db, model.Get_Jobs, status, limit)
+}
+
+// LastAttempt reports whether a failure of job's current attempt dead-letters it
+func LastAttempt(job model.Job) bool {
+	return job.Attempts >= MaxAttempts
+}
+
+// claim leases the oldest due job of kind, or returns nil if none is due
+func claim(ctx context.Context, db *sql.DB, kind, owner string) (*model.Job, error) {
+	now := time.Now().UTC()
+	job, err := model.ScanJob(db.QueryRowContext(ctx, model.Claim_Job, owner, now.Add(VisibilityTimeout), now, kind))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error claiming %s job: %w", kind, err)
+	}
+	return &job, nil
+}
+
+// run calls handle while renewing the job's lease every third of the visibility timeout
+func run(ctx context.Context, db *sql.DB, job model.Job, owner string, handle func(context.Context, model.Job) error) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(VisibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now().UTC()
+				_, err := db.Exec(model.Extend_Job_Lease, now.Add(VisibilityTimeout), now, job.ID, owner)
+				if err != nil {
+					slog.ErrorContext(ctx, "Job lease renewal error", "job", job.ID, "error", err)
+				}
+			}
+		}
+	}()
+
+	return handle(ctx, job)
+}
+
+// complete marks a leased job as done
+func complete(ctx context.Context, db *sql.DB, job model.Job, owner string) error {
+	res, err := db.ExecContext(ctx, model.Set_Job_done, time.Now().UTC(), job.ID, owner)
+	if err != nil {
+		return fmt.Errorf("error completing job %d: %w", job.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job %d: %w", job.ID, ErrLeaseLost)
+	}
+	return nil
+}
+
+// release gives an interrupted job back to the queue; if that fails, the job is claimed again once its lease expires
+func release(db *sql.DB, job model.Job, owner string) {
+	_, err := db.Exec(model.Set_Job_released, time.Now().UTC(), job.ID, owner)
+	if err != nil {
+		slog.Error("Job release error", "job", job.ID, "error", err)
+	}
+}
+
+// fail records a failed attempt and schedules the next one, or dead-letters the job after its last attempt
+func fail(ctx context.Context, db *sql.DB, job model.Job, owner string, jobErr error) (dead bool, err error) {
+	now := time.Now().UTC()
+	status, next := StatusPending, now.Add(backoff(job.Attempts))
+	if LastAttempt(job) {
+		status, next = StatusDead, now
+	}
+
+	res, err := db.ExecContext(ctx, model.Set_Job_failed, status, jobErr.Error(), next, now, job.ID, owner)
+	if err != nil {
+		return false, fmt.Errorf("error recording failure of job %d: %w", job.ID, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, fmt.Errorf("job %d: %w", job.ID, ErrLeaseLost)
+	}
+	return status == StatusDead, nil
+}
+
+// backoff returns the delay after the given number of failed attempts: Backoff doubled after each attempt but the
+// first, at most maxBackoff
+func backoff(attempts int) time.Duration {
+	delay := Backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// queryJobs reads jobs selected with the Jobs column list
+func queryJobs(ctx context.Context, db *sql.DB, query string, args ...any) ([]model.Job, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]model.Job, 0)
+	for rows.Next() {
+		job, err := model.ScanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -0,0 +1,30 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	defer func(b time.Duration) { Backoff = b }(Backoff)
+	tests := []struct {
+		backoff  time.Duration
+		attempts int
+		want     time.Duration
+	}{
+		{time.Minute, 1, time.Minute},
+		{time.Minute, 2, 2 * time.Minute},
+		{time.Minute, 5, 16 * time.Minute},
+		{time.Minute, 12, maxBackoff},
+		{time.Minute, 100, maxBackoff},
+		{time.Hour, 70, maxBackoff},
+		{48 * time.Hour, 1, maxBackoff},
+		{0, 10, 0},
+	}
+	for _, tt := range tests {
+		Backoff = tt.backoff
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) with Backoff %v = %v, want %v", tt.attempts, tt.backoff, got, tt.want)
+		}
+	}
+}
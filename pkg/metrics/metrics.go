@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets in seconds, from 5ms to 5 minutes
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// collector is a metric which can write itself in the Prometheus text format
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+var (
+	mu         sync.Mutex
+	collectors []collector
+)
+
+// register adds a metric to the output of Handler
+func register(c collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors = append(collectors, c)
+}
+
+// Handler serves all registered metrics in the Prometheus text exposition format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		mu.Lock()
+		list := append([]collector(nil), collectors...)
+		mu.Unlock()
+
+		bw := bufio.NewWriter(w)
+		for _, c := range list {
+			c.write(bw)
+		}
+		bw.Flush()
+	})
+}
+
+// series holds the values of a metric per label values combination
+type series struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newSeries(kind, name, help string, labels []string) *series {
+	return &series{name: name, help: help, kind: kind, labels: labels, values: make(map[string]float64)}
+}
+
+// key joins label values, checking their number
+func (s *series) key(labelValues []string) string {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", s.name, len(s.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (s *series) write(w *bufio.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", s.name, s.help, s.name, s.kind)
+	for _, key := range sortedKeys(s.values) {
+		fmt.Fprintf(w, "%s%s %s\n", s.name, labelString(s.labels, key, "", ""), formatFloat(s.values[key]))
+	}
+}
+
+// Counter is a monotonically increasing value, optionally split by labels
+type Counter struct {
+	s *series
+}
+
+// NewCounter registers a new counter
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{s: newSeries("counter", name, help, labels)}
+	register(c.s)
+	return c
+}
+
+// Inc adds 1 to the counter with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v (which must not be negative) to the counter with the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	key := c.s.key(labelValues)
+	c.s.mu.Lock()
+	c.s.values[key] += v
+	c.s.mu.Unlock()
+}
+
+// Gauge is a value which can go up and down, optionally split by labels
+type Gauge struct {
+	s *series
+}
+
+// NewGauge registers a new gauge
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{s: newSeries("gauge", name, help, labels)}
+	register(g.s)
+	return g
+}
+
+// Set sets the gauge with the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.s.key(labelValues)
+	g.s.mu.Lock()
+	g.s.values[key] = v
+	g.s.mu.Unlock()
+}
+
+// Histogram counts observations in buckets, optionally split by labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts map[string][]uint64 // per label key: count per bucket, cumulative on output
+	sums   map[string]float64
+	totals map[string]uint64
+}
+
+// NewHistogram registers a new histogram; nil buckets means DefaultBuckets
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	register(h)
+	return h
+}
+
+// Observe adds a single observation with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", h.name, len(h.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			counts[i]++
+			break
+		}
+	}
+	h.sums[key] += v
+	h.totals[key]++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.counts))
+	for key := range h.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += h.counts[key][i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, key, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(h.labels, key, "le", "+Inf"), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, key, "", ""), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, key, "", ""), h.totals[key])
+	}
+}
+
+// labelString formats {a="x",b="y"} from label names and a joined key, with an optional extra label
+func labelString(names []string, key, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(names)+1)
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, names[i]+"="+strconv.Quote(value))
+		}
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+strconv.Quote(extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatFloat formats a value the way Prometheus expects it
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
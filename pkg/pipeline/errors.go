@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Item kinds, used as the log attribute of an item error
+const (
+	KindFile = "file"
+	KindURL  = "url"
+)
+
+// ItemError is the failure of a single order file or URL
+type ItemError struct {
+	Kind string
+	Item string
+	Err  error
+}
+
+// FileError returns the failure of an order file
+func FileError(filename string, err error) *ItemError {
+	return &ItemError{Kind: KindFile, Item: filename, Err: err}
+}
+
+// URLError returns the failure of a URL
+func URLError(url string, err error) *ItemError {
+	return &ItemError{Kind: KindURL, Item: url, Err: err}
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Kind, e.Item, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// Errors aggregates the item failures of a stage which otherwise completed
+type Errors struct {
+	Items []*ItemError
+}
+
+// Add records an item failure; nil is ignored
+func (e *Errors) Add(item *ItemError) {
+	if item != nil && item.Err != nil {
+		e.Items = append(e.Items, item)
+	}
+}
+
+// Merge records all item failures of err if it is an aggregate, and returns err otherwise
+func (e *Errors) Merge(err error) error {
+	if items, ok := err.(*Errors); ok {
+		e.Items = append(e.Items, items.Items...)
+		return nil
+	}
+	return err
+}
+
+// Err returns the aggregate, or nil if no item failed
+func (e *Errors) Err() error {
+	if len(e.Items) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *Errors) Error() string {
+	if len(e.Items) == 1 {
+		return e.Items[0].Error()
+	}
+	const shown = 3
+	msgs := make([]string, 0, shown)
+	for _, item := range e.Items[:min(shown, len(e.Items))] {
+		msgs = append(msgs, item.Error())
+	}
+	if len(e.Items) > shown {
+		msgs = append(msgs, fmt.Sprintf("and %d more", len(e.Items)-shown))
+	}
+	return fmt.Sprintf("%d items failed: %s", len(e.Items), strings.Join(msgs, "; "))
+}
+
+func (e *Errors) Unwrap() []error {
+	errs := make([]error, len(e.Items))
+	for i, item := range e.Items {
+		errs[i] = item
+	}
+	return errs
+}
+
+// StageError is the error returned by a pipeline stage
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("stage %s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Partial reports whether err only holds item failures, so the stages themselves completed.
+// A nil error is not partial.
+func Partial(err error) bool {
+	if err == nil {
+		return false
+	}
+	return onlyItems(err)
+}
+
+// Items returns the item failures of all aggregates in err, which may join several of them
+func Items(err error) []*ItemError {
+	switch e := err.(type) {
+	case *Errors:
+		return e.Items
+	case *StageError:
+		return Items(e.Err)
+	case interface{ Unwrap() []error }:
+		var items []*ItemError
+		for _, inner := range e.Unwrap() {
+			items = append(items, Items(inner)...)
+		}
+		return items
+	}
+	return nil
+}
+
+// onlyItems reports whether every leaf of err is an item aggregate
+func onlyItems(err error) bool {
+	switch e := err.(type) {
+	case *Errors:
+		return true
+	case *StageError:
+		return onlyItems(e.Err)
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			if !onlyItems(inner) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
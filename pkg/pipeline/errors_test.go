@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestItems(t *testing.T) {
+	a := FileError("a.pdf", errors.New("missing"))
+	b := URLError("https://example.com/b.pdf", errors.New("status 404"))
+	c := FileError("c.pdf", errors.New("bad hash"))
+	fatal := errors.New("database is locked")
+
+	tests := []struct {
+		name    string
+		err     error
+		want    []*ItemError
+		partial bool
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name: "other error",
+			err:  fatal,
+		},
+		{
+			name:    "one aggregate",
+			err:     &Errors{Items: []*ItemError{a, b}},
+			want:    []*ItemError{a, b},
+			partial: true,
+		},
+		{
+			name:    "joined aggregates",
+			err:     errors.Join(&Errors{Items: []*ItemError{a}}, nil, &Errors{Items: []*ItemError{b, c}}),
+			want:    []*ItemError{a, b, c},
+			partial: true,
+		},
+		{
+			name:    "stage errors",
+			err:     errors.Join(&StageError{Stage: "check", Err: errors.Join(&Errors{Items: []*ItemError{a}}, &Errors{Items: []*ItemError{b}})}),
+			want:    []*ItemError{a, b},
+			partial: true,
+		},
+		{
+			name: "aggregate joined with other error",
+			err:  errors.Join(&Errors{Items: []*ItemError{a}}, fatal),
+			want: []*ItemError{a},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Items(tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Items = %v, want %v", got, tt.want)
+			}
+			if got := Partial(tt.err); got != tt.partial {
+				t.Errorf("Partial = %v, want %v", got, tt.partial)
+			}
+		})
+	}
+}
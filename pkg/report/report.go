@@ -0,0 +1,337 @@
+// Package report renders the monthly community report: SVG charts of order volume and processing trends with an
+// HTML page showing them, written to a folder which can be copied anywhere or hosted by the serve command.
+package report
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/stats"
+)
+
+// Report defaults
+const (
+	// DefaultMonths is the number of months charted, up to the month of the latest order
+	DefaultMonths = 24
+	// DefaultCohorts is the number of most recent dossier years in the processing front chart
+	DefaultCohorts = 6
+)
+
+// Files of a report folder
+const (
+	IndexFile           = "index.html"
+	OrdersChartFile     = "orders-per-month.svg"
+	DossiersChartFile   = "dossiers-per-month.svg"
+	FrontChartFile      = "processing-front.svg"
+	PercentileChartFile = "processing-times.svg"
+)
+
+// Options select what a report covers
+type Options struct {
+	Now     time.Time // generation time shown in the report, the current time if zero
+	Months  int       // months charted, DefaultMonths if 0
+	Cohorts int       // dossier years in the processing front chart, DefaultCohorts if 0
+}
+
+// Figure is a chart of the report with its caption
+type Figure struct {
+	File    string
+	Title   string
+	Caption string
+}
+
+// Report is what the index page shows
+type Report struct {
+	Generated time.Time
+	AsOf      string // date of the latest order, empty if no order is dated
+	From, To  string // first and last month charted, e.g. "2024-10"
+	Orders    int    // order files dated within the charted months
+	Dossiers  int    // dossiers resolved by them
+	Figures   []Figure
+}
+
+// Generate writes the charts and the index page to dir, creating it if needed, and returns the paths written.
+// Files are replaced atomically, so a report hosted by the serve command is never seen half written.
+func Generate(ctx context.Context, db *sql.DB, dir string, opts Options) ([]string, error) {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now().UTC()
+	}
+	if opts.Months <= 0 {
+		opts.Months = DefaultMonths
+	}
+	if opts.Cohorts <= 0 {
+		opts.Cohorts = DefaultCohorts
+	}
+
+	// Charted months end with the month of the latest order, so an outdated database doesn't chart empty months
+	r := Report{Generated: opts.Now}
+	if err := db.QueryRowContext(ctx, model.Get_Last_Order_Date).Scan(&r.AsOf); err != nil {
+		return nil, fmt.Errorf("error reading last order date: %w", err)
+	}
+	last := opts.Now
+	if asOf, err := time.Parse("2006-01-02", r.AsOf); err == nil {
+		last = asOf
+	}
+	last = time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC)
+	first := last.AddDate(0, 1-opts.Months, 0)
+	months := make([]string, 0, opts.Months)
+	for m := first; !m.After(last); m = m.AddDate(0, 1, 0) {
+		months = append(months, m.Format("2006-01"))
+	}
+	r.From, r.To = months[0], months[len(months)-1]
+	since := first.Format("2006-01-02")
+
+	orders, err := monthlyCounts(ctx, db, model.Get_Order_Files_per_Month, since, months)
+	if err != nil {
+		return nil, fmt.Errorf("error counting order files: %w", err)
+	}
+	dossiers, err := monthlyCounts(ctx, db, model.Get_Dossiers_per_Month, since, months)
+	if err != nil {
+		return nil, fmt.Errorf("error counting dossiers: %w", err)
+	}
+	for i := range months {
+		r.Orders += int(orders[i])
+		r.Dossiers += int(dossiers[i])
+	}
+	front, err := frontSeries(ctx, db, since, months, opts.Cohorts)
+	if err != nil {
+		return nil, err
+	}
+	percentiles, err := percentileSeries(ctx, db, first, last, months)
+	if err != nil {
+		return nil, err
+	}
+
+	charts := []struct {
+		Figure
+		Chart
+	}{
+		{
+			Figure{File: OrdersChartFile, Title: "Orders per month",
+				Caption: "Order files published per month, by order date."},
+			Chart{Unit: "orders", Series: []Series{{Name: "Orders", Values: orders}}, Bars: true},
+		},
+		{
+			Figure{File: DossiersChartFile, Title: "Dossiers per month",
+				Caption: "Dossiers resolved per month: dossier numbers parsed from the orders of the month."},
+			Chart{Unit: "dossiers", Series: []Series{{Name: "Dossiers", Values: dossiers}}, Bars: true},
+		},
+		{
+			Figure{File: FrontChartFile, Title: "Processing front per dossier year",
+				Caption: "Highest dossier number of each registration year resolved by the orders of the month. " +
+					"A rising line means the year is being worked through; a missing point means no dossiers of that " +
+					"year were resolved that month."},
+			Chart{Unit: "dossier number", Series: front},
+		},
+		{
+			Figure{File: PercentileChartFile, Title: "Processing time percentiles",
+				Caption: "Months from registration to order of the dossiers resolved each month. Orders only give " +
+					"the registration year, so dossiers are taken as registered on 1 July; single times are off by up " +
+					"to six months."},
+			Chart{Unit: "months", Series: percentiles},
+		},
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating report folder %s: %w", dir, err)
+	}
+	var written []string
+	for _, c := range charts {
+		c.Chart.Title, c.Chart.Labels = c.Figure.Title, months
+		path := filepath.Join(dir, c.File)
+		if err := writeFile(path, c.Chart.SVG()); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+		r.Figures = append(r.Figures, c.Figure)
+	}
+
+	var index strings.Builder
+	if err := indexPage.Execute(&index, r); err != nil {
+		return written, fmt.Errorf("error rendering report index: %w", err)
+	}
+	path := filepath.Join(dir, IndexFile)
+	if err := writeFile(path, []byte(index.String())); err != nil {
+		return written, err
+	}
+	return append(written, path), nil
+}
+
+// Handler serves a report folder, e.g. mounted under /report/ by the serve command
+func Handler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reports are regenerated in place, so clients revalidate instead of caching stale charts
+		w.Header().Set("Cache-Control", "no-cache")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// monthlyCounts runs a (Month, count) query and returns the counts of months, 0 for months without rows
+func monthlyCounts(ctx context.Context, db *sql.DB, query, since string, months []string) ([]float64, error) {
+	rows, err := db.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]float64)
+	for rows.Next() {
+		var (
+			month string
+			count int
+		)
+		if err := rows.Scan(&month, &count); err != nil {
+			return nil, err
+		}
+		counts[month] = float64(count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, len(months))
+	for i, month := range months {
+		values[i] = counts[month]
+	}
+	return values, nil
+}
+
+// frontSeries returns the highest dossier number resolved per month of the cohorts most recent dossier years
+// which have orders in the charted months, one series per year, oldest year first
+func frontSeries(ctx context.Context, db *sql.DB, since string, months []string, cohorts int) ([]Series, error) {
+	rows, err := db.QueryContext(ctx, model.Get_Front_per_Month, since)
+	if err != nil {
+		return nil, fmt.Errorf("error reading processing front: %w", err)
+	}
+	defer rows.Close()
+
+	index := make(map[string]int, len(months))
+	for i, month := range months {
+		index[month] = i
+	}
+	years := make(map[uint][]float64)
+	for rows.Next() {
+		var (
+			month   string
+			year    uint
+			highest uint
+		)
+		if err := rows.Scan(&month, &year, &highest); err != nil {
+			return nil, fmt.Errorf("error scanning processing front: %w", err)
+		}
+		i, ok := index[month]
+		if !ok {
+			continue
+		}
+		if years[year] == nil {
+			years[year] = nanSlice(len(months))
+		}
+		years[year][i] = float64(highest)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sorted := make([]uint, 0, len(years))
+	for year := range years {
+		sorted = append(sorted, year)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if len(sorted) > cohorts {
+		sorted = sorted[len(sorted)-cohorts:]
+	}
+	series := make([]Series, 0, len(sorted))
+	for _, year := range sorted {
+		series = append(series, Series{Name: strconv.Itoa(int(year)), Values: years[year]})
+	}
+	return series, nil
+}
+
+// percentileSeries returns the 25th, 50th, 75th and 90th percentile processing times per month, NaN for months
+// without dossiers
+func percentileSeries(ctx context.Context, db *sql.DB, first, last time.Time, months []string) ([]Series, error) {
+	monthly, err := stats.Monthly(ctx, db, first, last)
+	if err != nil {
+		return nil, err
+	}
+	series := []Series{
+		{Name: "25th percentile", Values: nanSlice(len(months))},
+		{Name: "Median", Values: nanSlice(len(months))},
+		{Name: "75th percentile", Values: nanSlice(len(months))},
+		{Name: "90th percentile", Values: nanSlice(len(months))},
+	}
+	for i, d := range monthly {
+		if i >= len(months) || d.Dossiers == 0 {
+			continue
+		}
+		series[0].Values[i], series[1].Values[i] = d.P25, d.Median
+		series[2].Values[i], series[3].Values[i] = d.P75, d.P90
+	}
+	return series, nil
+}
+
+func nanSlice(n int) []float64 {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return values
+}
+
+// writeFile writes data to a temporary file next to path and renames it over path
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+var indexPage = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.UTC().Format("2006-01-02 15:04 UTC")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Citizenship orders report {{.To}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 920px; padding: 0 1em; }
+figure { margin: 2em 0; }
+img { max-width: 100%; height: auto; border: 1px solid #eee; }
+figcaption { color: #555; margin-top: 0.5em; }
+.caveat { color: #777; font-size: 0.9em; }
+</style>
+</head>
+<body>
+<h1>Citizenship orders report</h1>
+<p>{{if .AsOf}}Orders up to {{.AsOf}}{{else}}No dated orders yet{{end}}, charted from {{.From}} to {{.To}}:
+{{.Orders}} order files resolving {{.Dossiers}} dossiers. Generated {{time .Generated}}.</p>
+{{range .Figures}}<figure>
+<h2>{{.Title}}</h2>
+<img src="{{.File}}" alt="{{.Title}}">
+<figcaption>{{.Caption}}</figcaption>
+</figure>
+{{end}}<p class="caveat">The latest month may be incomplete. Orders published late or not parsed yet are missing from
+the charts, and dossiers are not resolved strictly in number order.</p>
+</body>
+</html>
+`))
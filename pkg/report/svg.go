@@ -0,0 +1,187 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Chart size and margins in pixels
+const (
+	chartWidth   = 880
+	chartHeight  = 360
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 40
+	marginBottom = 40
+	legendItem   = 120 // width of a legend entry
+	legendRow    = 20  // height of a legend row
+)
+
+// palette colours the series of a chart in order, repeating when there are more series
+var palette = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd", "#8c564b", "#e377c2", "#7f7f7f"}
+
+// Series is a named row of values of a chart, one per label; NaN values are missing and break the line
+type Series struct {
+	Name   string
+	Values []float64
+}
+
+// Chart is a bar or line chart over labels, e.g. months
+type Chart struct {
+	Title  string
+	Unit   string   // y axis title
+	Labels []string // x axis labels
+	Series []Series
+	Bars   bool // draws the first series as bars instead of lines
+}
+
+// SVG renders the chart as a standalone SVG document, with a tooltip on every bar and point
+func (c Chart) SVG() []byte {
+	plotWidth := chartWidth - marginLeft - marginRight
+	plotHeight := chartHeight - marginTop - marginBottom
+
+	// The legend goes below the x axis, only when there is more than one series
+	legendRows := 0
+	perRow := max(1, plotWidth/legendItem)
+	if len(c.Series) > 1 {
+		legendRows = (len(c.Series) + perRow - 1) / perRow
+	}
+	height := chartHeight + legendRows*legendRow
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n",
+		chartWidth, height, chartWidth, height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="#fff"/>`+"\n")
+	fmt.Fprintf(&b, `<text x="%d" y="22" font-size="16" font-weight="bold">%s</text>`+"\n", marginLeft, escape(c.Title))
+
+	// Y axis: about five round steps from zero to above the highest value
+	highest := 0.0
+	for _, s := range c.Series {
+		for _, v := range s.Values {
+			if !math.IsNaN(v) {
+				highest = math.Max(highest, v)
+			}
+		}
+	}
+	step := niceStep(highest / 5)
+	top := math.Max(step, math.Ceil(highest/step)*step)
+	y := func(v float64) float64 { return float64(marginTop+plotHeight) - v/top*float64(plotHeight) }
+	for i := 0; float64(i)*step <= top+step/2; i++ {
+		v := float64(i) * step
+		fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%.1f" y2="%.1f" stroke="#ddd"/>`+"\n",
+			marginLeft, marginLeft+plotWidth, y(v), y(v))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`+"\n",
+			marginLeft-6, y(v), formatTick(v, step))
+	}
+	fmt.Fprintf(&b, `<text transform="translate(14 %d) rotate(-90)" text-anchor="middle">%s</text>`+"\n",
+		marginTop+plotHeight/2, escape(c.Unit))
+
+	// X axis: at most about twelve labels
+	n := len(c.Labels)
+	band := float64(plotWidth) / float64(max(n, 1))
+	x := func(i int) float64 { return float64(marginLeft) + band*(float64(i)+0.5) }
+	every := max(1, (n+11)/12)
+	for i, label := range c.Labels {
+		if i%every != 0 {
+			continue
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n",
+			x(i), marginTop+plotHeight+18, escape(label))
+	}
+	fmt.Fprintf(&b, `<line x1="%d" x2="%d" y1="%d" y2="%d" stroke="#333"/>`+"\n",
+		marginLeft, marginLeft+plotWidth, marginTop+plotHeight, marginTop+plotHeight)
+
+	for i, s := range c.Series {
+		colour := palette[i%len(palette)]
+		if c.Bars && i == 0 {
+			for j, v := range s.Values {
+				if j >= n || math.IsNaN(v) {
+					continue
+				}
+				fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`+"\n",
+					x(j)-band*0.4, y(v), band*0.8, y(0)-y(v), colour, escape(c.Labels[j]), formatValue(v))
+			}
+			continue
+		}
+
+		// Line segments between consecutive known values, with a dot on every value
+		var path strings.Builder
+		pen := "M"
+		for j, v := range s.Values {
+			if j >= n || math.IsNaN(v) {
+				pen = "M"
+				continue
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f ", pen, x(j), y(v))
+			pen = "L"
+		}
+		if path.Len() > 0 {
+			fmt.Fprintf(&b, `<path d="%s" fill="none" stroke="%s" stroke-width="2"/>`+"\n",
+				strings.TrimSpace(path.String()), colour)
+		}
+		for j, v := range s.Values {
+			if j >= n || math.IsNaN(v) {
+				continue
+			}
+			fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="2.5" fill="%s"><title>%s %s: %s</title></circle>`+"\n",
+				x(j), y(v), colour, escape(s.Name), escape(c.Labels[j]), formatValue(v))
+		}
+	}
+
+	// Legend
+	if legendRows > 0 {
+		for i, s := range c.Series {
+			lx := marginLeft + (i%perRow)*legendItem
+			ly := chartHeight + (i/perRow)*legendRow
+			fmt.Fprintf(&b, `<rect x="%d" y="%d" width="12" height="12" fill="%s"/>`+"\n",
+				lx, ly-10, palette[i%len(palette)])
+			fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`+"\n", lx+18, ly, escape(s.Name))
+		}
+	}
+
+	if n == 0 {
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="middle" fill="#777">No data</text>`+"\n",
+			marginLeft+plotWidth/2, marginTop+plotHeight/2)
+	}
+	b.WriteString("</svg>\n")
+	return []byte(b.String())
+}
+
+// niceStep rounds a raw axis step up to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, m := range []float64{1, 2, 5} {
+		if raw <= m*magnitude {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatTick formats an axis value with as many decimals as the step needs
+func formatTick(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = int(math.Ceil(-math.Log10(step)))
+	}
+	return strconv.FormatFloat(v, 'f', decimals, 64)
+}
+
+// formatValue formats a tooltip value, whole numbers without decimals
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+// escape escapes text for SVG content and attributes
+func escape(s string) string {
+	return html.EscapeString(s)
+}
@@ -0,0 +1,86 @@
+package snapshots
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Hash returns the hex encoded SHA-256 of a listing body, used to detect changed pages
+func Hash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Save compresses body and stores it under dir/<source>/<timestamp>.html.gz.
+// Returns the path of the stored snapshot.
+func Save(dir, source string, fetchedAt time.Time, body []byte) (string, error) {
+	// Create the folder for the source
+	folder := filepath.Join(dir, sourceKey(source))
+	if err := os.MkdirAll(folder, 0750); err != nil {
+		return "", fmt.Errorf("error creating snapshot folder %s: %w", folder, err)
+	}
+
+	// Compress the body
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = source
+	zw.ModTime = fetchedAt
+	if _, err := zw.Write(body); err != nil {
+		return "", fmt.Errorf("error compressing snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("error compressing snapshot: %w", err)
+	}
+
+	// Write the compressed body to a new file
+	path := filepath.Join(folder, fetchedAt.UTC().Format("20060102T150405.000000000Z")+".html.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0640); err != nil {
+		return "", fmt.Errorf("error writing snapshot %s: %w", path, err)
+	}
+
+	return path, nil
+}
+
+// Load reads and decompresses a snapshot stored by Save
+func Load(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot %s: %w", path, err)
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing snapshot %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot %s: %w", path, err)
+	}
+	return body, nil
+}
+
+// sourceKey turns a source URL into a folder name
+// Example: "https://cetatenie.just.ro/ordine-articolul-1-1/" -> "cetatenie.just.ro_ordine-articolul-1-1"
+func sourceKey(source string) string {
+	s := strings.TrimPrefix(source, "https://")
+	s = strings.TrimPrefix(s, "http://")
+	s = strings.Trim(s, "/")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,77 @@
+package snapshots
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	source := "https://cetatenie.just.ro/ordine-articolul-1-1/"
+	fetchedAt := time.Date(2023, 10, 26, 9, 30, 15, 123, time.FixedZone("EEST", 3*60*60))
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "listing", body: `<ul><li><strong>26.10.2023</strong> <a href="/o/1795.pdf">1795P</a></li></ul>`},
+		{name: "empty body"},
+		{name: "large body", body: strings.Repeat("<li>Ordin 1795/P/2023 Ștefan</li>\n", 10000)},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := fetchedAt.Add(time.Duration(i) * time.Second)
+			path, err := Save(dir, source, at, []byte(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := filepath.Join(dir, "cetatenie.just.ro_ordine-articolul-1-1", at.UTC().Format("20060102T150405.000000000Z")+".html.gz")
+			if path != want {
+				t.Errorf("path = %s, want %s", path, want)
+			}
+			body, err := Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(body) != tt.body {
+				t.Errorf("loaded %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.html.gz")); err == nil {
+		t.Error("loading a missing snapshot succeeded")
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		body, want string
+	}{
+		{body: "", want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{body: "abc", want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	for _, tt := range tests {
+		if got := Hash([]byte(tt.body)); got != tt.want {
+			t.Errorf("Hash(%q) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestSourceKey(t *testing.T) {
+	tests := []struct {
+		source, want string
+	}{
+		{source: "https://cetatenie.just.ro/ordine-articolul-1-1/", want: "cetatenie.just.ro_ordine-articolul-1-1"},
+		{source: "http://cetatenie.just.ro/ordine-articolul-11/", want: "cetatenie.just.ro_ordine-articolul-11"},
+		{source: "https://example.com:8443/a?b=c&d", want: "example.com_8443_a_b_c_d"},
+		{source: "https://example.com/../etc", want: "example.com_.._etc"},
+	}
+	for _, tt := range tests {
+		if got := sourceKey(tt.source); got != tt.want {
+			t.Errorf("sourceKey(%q) = %s, want %s", tt.source, got, tt.want)
+		}
+	}
+}
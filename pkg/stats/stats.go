@@ -0,0 +1,241 @@
+// Package stats computes how long dossiers take from registration to the order which resolves them
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+)
+
+// DefaultWindows are the rolling windows, in days before now, used when none are given
+var DefaultWindows = []int{90, 180, 365}
+
+// daysPerMonth is the average month length used to express elapsed time in months
+const daysPerMonth = 365.25 / 12
+
+// Options select the processing times to compute
+type Options struct {
+	Now     time.Time // end of every window, the current time if zero
+	Windows []int     // rolling windows in days, DefaultWindows if empty
+	Source  string    // only orders found on this listing page if not empty
+	Series  string    // only orders of this series, e.g. "P", if not empty
+}
+
+// Distribution summarizes the processing times, in months, of the dossiers resolved by orders dated within a
+// window. Orders only give the registration year of a dossier, so dossiers are taken as registered on 1 July of
+// that year; single times are off by up to six months, but the half-year errors even out in the quantiles.
+type Distribution struct {
+	Window   string    `json:"window"` // e.g. "90d"
+	From     time.Time `json:"from"`   // first order date of the window
+	To       time.Time `json:"to"`     // last order date of the window
+	Source   string    `json:"source"` // listing page of the orders, "" for all sources
+	Series   string    `json:"series"` // order series, "" for all series
+	Dossiers int       `json:"dossiers"`
+	Min      float64   `json:"min"`
+	P25      float64   `json:"p25"`
+	Median   float64   `json:"median"`
+	P75      float64   `json:"p75"`
+	P90      float64   `json:"p90"`
+	Max      float64   `json:"max"`
+	Mean     float64   `json:"mean"`
+}
+
+// ParseWindows parses a comma separated list of window lengths in days, e.g. "90,180,365"
+func ParseWindows(s string) ([]int, error) {
+	var windows []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSuffix(strings.TrimSpace(part), "d")
+		if part == "" {
+			continue
+		}
+		days, err := strconv.Atoi(part)
+		if err != nil || days < 1 {
+			return nil, fmt.Errorf("invalid window %q, expected a number of days", part)
+		}
+		windows = append(windows, days)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no windows in %q", s)
+	}
+	return windows, nil
+}
+
+// sample is a number of dossiers with the same processing time
+type sample struct {
+	months float64
+	count  int
+}
+
+// datedSample is a sample of the orders of one source, series and date
+type datedSample struct {
+	key       groupKey
+	orderDate time.Time
+	sample
+}
+
+// groupKey is a source and order series; empty fields stand for all of them
+type groupKey struct {
+	source string
+	series string
+}
+
+// ProcessingTimes returns the distributions of every window for all orders, per source and per source and series,
+// in that order within each window. Groups without dossiers are left out, except the one over all orders.
+func ProcessingTimes(ctx context.Context, db *sql.DB, opts Options) ([]Distribution, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now().UTC()
+	}
+	windows := opts.Windows
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	longest := 0
+	for _, days := range windows {
+		longest = max(longest, days)
+	}
+	from := to.AddDate(0, 0, 1-longest)
+
+	all, err := readSamples(ctx, db, from, to, opts.Source, opts.Series)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Distribution, 0)
+	for _, days := range windows {
+		windowFrom := to.AddDate(0, 0, 1-days)
+		groups := map[groupKey][]sample{{}: nil}
+		for _, r := range all {
+			if r.orderDate.Before(windowFrom) {
+				continue
+			}
+			keys := []groupKey{{}, {source: r.key.source}}
+			// Orders without series only count for their source
+			if r.key.series != "" {
+				keys = append(keys, r.key)
+			}
+			for _, key := range keys {
+				groups[key] = append(groups[key], r.sample)
+			}
+		}
+
+		keys := make([]groupKey, 0, len(groups))
+		for key := range groups {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].source != keys[j].source {
+				return keys[i].source < keys[j].source
+			}
+			return keys[i].series < keys[j].series
+		})
+		for _, key := range keys {
+			d := summarize(groups[key])
+			d.Window, d.From, d.To = strconv.Itoa(days)+"d", windowFrom, to
+			d.Source, d.Series = key.source, key.series
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+// summarize returns the quantiles of weighted samples, rounded to a tenth of a month
+func summarize(samples []sample) Distribution {
+	var d Distribution
+	sort.Slice(samples, func(i, j int) bool { return samples[i].months < samples[j].months })
+	var sum float64
+	for _, s := range samples {
+		d.Dossiers += s.count
+		sum += s.months * float64(s.count)
+	}
+	if d.Dossiers == 0 {
+		return d
+	}
+
+	// Nearest-rank quantile over the expanded samples
+	quantile := func(q float64) float64 {
+		rank := int(math.Ceil(q * float64(d.Dossiers)))
+		seen := 0
+		for _, s := range samples {
+			seen += s.count
+			if seen >= rank {
+				return s.months
+			}
+		}
+		return samples[len(samples)-1].months
+	}
+	round := func(v float64) float64 { return math.Round(v*10) / 10 }
+
+	d.Min = round(samples[0].months)
+	d.P25 = round(quantile(0.25))
+	d.Median = round(quantile(0.5))
+	d.P75 = round(quantile(0.75))
+	d.P90 = round(quantile(0.9))
+	d.Max = round(samples[len(samples)-1].months)
+	d.Mean = round(sum / float64(d.Dossiers))
+	return d
+}
+
+// Monthly returns the distribution over all orders of every calendar month from the month of from to the month of
+// to, oldest first; Window is the month, e.g. "2026-09". Months without dossiers are included with zero values.
+func Monthly(ctx context.Context, db *sql.DB, from, to time.Time) ([]Distribution, error) {
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, -1)
+	all, err := readSamples(ctx, db, first, last, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	months := make(map[string][]sample)
+	for _, r := range all {
+		month := r.orderDate.Format("2006-01")
+		months[month] = append(months[month], r.sample)
+	}
+
+	result := make([]Distribution, 0)
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		d := summarize(months[month.Format("2006-01")])
+		d.Window, d.From, d.To = month.Format("2006-01"), month, month.AddDate(0, 1, -1)
+		result = append(result, d)
+	}
+	return result, nil
+}
+
+// readSamples reads the processing times of the orders dated from..to, optionally of one source and series
+func readSamples(ctx context.Context, db *sql.DB, from, to time.Time, source, series string) ([]datedSample, error) {
+	rows, err := db.QueryContext(ctx, model.Get_Processing_Times, from.Format("2006-01-02"), to.Format("2006-01-02"),
+		source, series)
+	if err != nil {
+		return nil, fmt.Errorf("error reading processing times: %w", err)
+	}
+	defer rows.Close()
+
+	var all []datedSample
+	for rows.Next() {
+		var (
+			r         datedSample
+			orderDate string
+			year      int
+		)
+		if err := rows.Scan(&r.key.source, &r.key.series, &orderDate, &year, &r.count); err != nil {
+			return nil, fmt.Errorf("error scanning processing time: %w", err)
+		}
+		r.orderDate, err = time.Parse("2006-01-02", orderDate)
+		if err != nil {
+			continue
+		}
+		// Dossiers are registered before their order, so times below zero are rounding of the mid-year guess
+		registered := time.Date(year, time.July, 1, 0, 0, 0, 0, time.UTC)
+		r.months = math.Max(0, r.orderDate.Sub(registered).Hours()/24/daysPerMonth)
+		all = append(all, r)
+	}
+	return all, rows.Err()
+}
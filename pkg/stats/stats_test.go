@@ -0,0 +1,42 @@
+package stats
+
+import "testing"
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []sample
+		want    Distribution
+	}{
+		{
+			name: "no samples",
+		},
+		{
+			name:    "single sample",
+			samples: []sample{{months: 30.04, count: 1}},
+			want:    Distribution{Dossiers: 1, Min: 30, P25: 30, Median: 30, P75: 30, P90: 30, Max: 30, Mean: 30},
+		},
+		{
+			name:    "unsorted samples",
+			samples: []sample{{months: 40, count: 1}, {months: 10, count: 1}, {months: 30, count: 1}, {months: 20, count: 1}},
+			want:    Distribution{Dossiers: 4, Min: 10, P25: 10, Median: 20, P75: 30, P90: 40, Max: 40, Mean: 25},
+		},
+		{
+			name:    "weighted samples",
+			samples: []sample{{months: 12, count: 9}, {months: 48, count: 1}},
+			want:    Distribution{Dossiers: 10, Min: 12, P25: 12, Median: 12, P75: 12, P90: 12, Max: 48, Mean: 15.6},
+		},
+		{
+			name:    "zero counts",
+			samples: []sample{{months: 12, count: 0}},
+			want:    Distribution{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize(tt.samples); got != tt.want {
+				t.Errorf("summarize = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Options configure the pooled transport shared by all outbound requests
+type Options struct {
+	Proxy           string // http://, https:// or socks5:// proxy URL; empty uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	CABundle        string // PEM file with certificates trusted in addition to the system pool
+	MaxConnsPerHost int    // limit of simultaneous connections to one host, 0 for no limit
+	Gzip            bool   // request gzip compressed responses and decompress them transparently
+}
+
+// NewTransport returns a pooled transport built from opts
+func NewTransport(opts Options) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing proxy URL: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   max(opts.MaxConnsPerHost, http.DefaultMaxIdleConnsPerHost),
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		DisableCompression:    !opts.Gzip,
+	}, nil
+}
+
+// Configure replaces Transport with a pooled transport built from opts.
+// It must be called before record or replay mode wraps Transport.
+func Configure(opts Options) error {
+	transport, err := NewTransport(opts)
+	if err != nil {
+		return err
+	}
+	Transport = transport
+	return nil
+}
+
+// NewClient returns a client sending requests through the shared transport with metrics and the bot User-Agent.
+// Clients are cheap: connections are pooled by the transport, not by the client.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: userAgentTransport{next: RoundTripper()},
+		Timeout:   timeout,
+	}
+}
+
+// userAgentTransport sets UserAgent on requests which don't have one
+type userAgentTransport struct {
+	next http.RoundTripper
+}
+
+func (t userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	return t.next.RoundTrip(req)
+}
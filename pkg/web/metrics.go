@@ -0,0 +1,39 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"romaniabot/pkg/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounter("romaniabot_http_requests_total",
+		"Outbound HTTP requests by method and response status (\"error\" if no response was received).", "method", "status")
+	requestDuration = metrics.NewHistogram("romaniabot_http_request_duration_seconds",
+		"Time until outbound HTTP response headers were received.", nil, "method")
+)
+
+// meteredTransport counts requests and their latency
+type meteredTransport struct {
+	next http.RoundTripper
+}
+
+// RoundTripper returns the shared Transport wrapped with request metrics, for use in http.Client
+func RoundTripper() http.RoundTripper {
+	return meteredTransport{next: Transport}
+}
+
+func (t meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	requestDuration.Observe(time.Since(start).Seconds(), req.Method)
+
+	if err != nil {
+		requestsTotal.Inc(req.Method, "error")
+		return nil, err
+	}
+	requestsTotal.Inc(req.Method, strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
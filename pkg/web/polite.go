@@ -0,0 +1,284 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"romaniabot/pkg/metrics"
+)
+
+// ErrDisallowed is returned for crawl requests denied by the site's robots.txt
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// Politeness configures how crawl requests treat the sites they fetch
+type Politeness struct {
+	RespectRobots bool          // fetch robots.txt and honour Disallow and Crawl-delay
+	MinDelay      time.Duration // delay between requests to one host when robots.txt sets no Crawl-delay
+	QuietHours    QuietHours    // time of day when crawl requests wait
+}
+
+// politeness is used by clients returned by NewCrawlClient
+var politeness = Politeness{RespectRobots: true, MinDelay: time.Second}
+
+// SetPoliteness replaces the politeness settings and forgets cached robots.txt files
+func SetPoliteness(p Politeness) {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	politeness = p
+	hosts = make(map[string]*hostState)
+}
+
+const (
+	robotsTTL        = 24 * time.Hour
+	robotsFailureTTL = time.Hour
+	// maxRetryAfter caps the wait requested by a server, so a bogus header doesn't stop the bot for days
+	maxRetryAfter = time.Hour
+)
+
+var deniedTotal = metrics.NewCounter("romaniabot_http_denied_total",
+	"Crawl requests not sent because robots.txt disallows them.")
+
+// hostState is the politeness state of one scheme://host
+type hostState struct {
+	mu           sync.Mutex
+	robots       *robots
+	next         time.Time // earliest start of the next request
+	blockedUntil time.Time // set from Retry-After
+}
+
+var (
+	hostsMu sync.Mutex
+	hosts   = make(map[string]*hostState)
+)
+
+// host returns the state of the request's site
+func host(req *http.Request) *hostState {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	key := req.URL.Scheme + "://" + req.URL.Host
+	h, ok := hosts[key]
+	if !ok {
+		h = &hostState{}
+		hosts[key] = h
+	}
+	return h
+}
+
+// NewCrawlClient returns a client for requests to scraped sites.
+// Requests wait for quiet hours, Crawl-delay and Retry-After, and fail with ErrDisallowed when robots.txt denies them.
+// The timeout starts once the request is allowed to go.
+func NewCrawlClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: politeTransport{next: userAgentTransport{next: RoundTripper()}, timeout: timeout},
+	}
+}
+
+// politeTransport delays or denies requests according to the politeness settings
+type politeTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	p := currentPoliteness()
+
+	// Pause during quiet hours
+	if until, quiet := p.QuietHours.Until(time.Now()); quiet {
+		slog.InfoContext(ctx, "Quiet hours, crawling paused", "until", until.Format(time.RFC3339), "url", req.URL.String())
+		if err := sleep(ctx, time.Until(until)); err != nil {
+			return nil, err
+		}
+	}
+
+	h := host(req)
+	delay := p.MinDelay
+
+	if p.RespectRobots {
+		rules, err := h.rules(ctx, t.next, req)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.allowed(req.URL.RequestURI()) {
+			deniedTotal.Inc()
+			slog.WarnContext(ctx, "URL disallowed by robots.txt, not fetched", "url", req.URL.String())
+			return nil, fmt.Errorf("%s: %w", req.URL, ErrDisallowed)
+		}
+		if rules.crawlDelay > 0 {
+			delay = rules.crawlDelay
+		}
+	}
+
+	if err := sleep(ctx, time.Until(h.reserve(delay))); err != nil {
+		return nil, err
+	}
+
+	// The timeout covers the request itself, not the wait above
+	var cancel context.CancelFunc = func() {}
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		req = req.WithContext(ctx)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			h.block(wait)
+			slog.WarnContext(ctx, "Server asked to retry later", "url", req.URL.String(), "status", resp.StatusCode, "wait", wait.String())
+		}
+	}
+
+	resp.Body = cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// currentPoliteness returns the politeness settings
+func currentPoliteness() Politeness {
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	return politeness
+}
+
+// reserve books the next request slot on the host and returns its start time
+func (h *hostState) reserve(delay time.Duration) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	start := time.Now()
+	if h.next.After(start) {
+		start = h.next
+	}
+	if h.blockedUntil.After(start) {
+		start = h.blockedUntil
+	}
+	h.next = start.Add(delay)
+	return start
+}
+
+// block delays all further requests to the host by wait
+func (h *hostState) block(wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if until := time.Now().Add(wait); until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
+
+// rules returns the host's cached robots.txt rules, fetching them when missing or expired.
+// The fetch runs without the host lock, so requests to the host with cached rules aren't held up by it.
+// An error is returned only when ctx ended the fetch; that failure says nothing about the site and isn't cached.
+func (h *hostState) rules(ctx context.Context, next http.RoundTripper, req *http.Request) (*robots, error) {
+	h.mu.Lock()
+	cached := h.robots
+	h.mu.Unlock()
+	if cached != nil && time.Since(cached.fetchedAt) < cached.ttl {
+		return cached, nil
+	}
+
+	robotsURL := req.URL.Scheme + "://" + req.URL.Host + "/robots.txt"
+	fetched, err := fetchRobots(ctx, next, robotsURL)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// Unreachable robots.txt means the site may not be crawled for now (RFC 9309, section 2.3.1.4)
+		slog.WarnContext(ctx, "robots.txt unavailable, host treated as disallowed", "url", robotsURL, "error", err)
+		fetched = &robots{rules: []robotsRule{{allow: false, pattern: "/"}}, ttl: robotsFailureTTL}
+	} else {
+		fetched.ttl = robotsTTL
+	}
+	fetched.fetchedAt = time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.robots = fetched
+	return fetched, nil
+}
+
+// fetchRobots downloads and parses robots.txt.
+// A missing file (4xx) allows everything; server errors are returned as errors.
+func fetchRobots(ctx context.Context, next http.RoundTripper, robotsURL string) (*robots, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := (&http.Client{Transport: next}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", robotsURL, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, robotsURL)
+	case resp.StatusCode >= 400:
+		return &robots{}, nil
+	}
+
+	agent, _, _ := strings.Cut(UserAgent, "/")
+	return parseRobots(io.LimitReader(resp.Body, 500<<10), agent), nil
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = date.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+	return min(wait, maxRetryAfter), true
+}
+
+// sleep waits for d or until ctx is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cancelBody releases the request timeout when the response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
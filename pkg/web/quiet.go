@@ -0,0 +1,63 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily time range when crawling pauses; it may wrap midnight, e.g. 22:00-06:00.
+// The zero value has no quiet hours.
+type QuietHours struct {
+	Start, End time.Duration // offsets from midnight
+	Location   *time.Location
+}
+
+// ParseQuietHours parses "HH:MM-HH:MM" in the given location; an empty string means no quiet hours
+func ParseQuietHours(value string, loc *time.Location) (QuietHours, error) {
+	if value == "" {
+		return QuietHours{}, nil
+	}
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return QuietHours{}, fmt.Errorf("quiet hours %q are not HH:MM-HH:MM", value)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("error parsing quiet hours start: %w", err)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return QuietHours{}, fmt.Errorf("error parsing quiet hours end: %w", err)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	return QuietHours{
+		Start:    time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		End:      time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute,
+		Location: loc,
+	}, nil
+}
+
+// Until reports whether now is within quiet hours and when they end
+func (q QuietHours) Until(now time.Time) (time.Time, bool) {
+	if q.Start == q.End || q.Location == nil {
+		return time.Time{}, false
+	}
+
+	now = now.In(q.Location)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, q.Location)
+	offset := now.Sub(midnight)
+
+	switch {
+	case q.Start < q.End && offset >= q.Start && offset < q.End:
+		return midnight.Add(q.End), true
+	case q.Start > q.End && offset >= q.Start:
+		// Started today, ends tomorrow
+		return midnight.AddDate(0, 0, 1).Add(q.End), true
+	case q.Start > q.End && offset < q.End:
+		return midnight.Add(q.End), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,68 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		value      string
+		start, end time.Duration
+		wantErr    bool
+	}{
+		{value: ""},
+		{value: "01:00-06:30", start: time.Hour, end: 6*time.Hour + 30*time.Minute},
+		{value: "22:00 - 05:00", start: 22 * time.Hour, end: 5 * time.Hour},
+		{value: "22:00", wantErr: true},
+		{value: "22-05", wantErr: true},
+		{value: "25:00-05:00", wantErr: true},
+		{value: "22:00-5:60", wantErr: true},
+	}
+	for _, tt := range tests {
+		q, err := ParseQuietHours(tt.value, time.UTC)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseQuietHours(%q) = %+v, want an error", tt.value, q)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseQuietHours(%q): %v", tt.value, err)
+			continue
+		}
+		if q.Start != tt.start || q.End != tt.end {
+			t.Errorf("ParseQuietHours(%q) = %v-%v, want %v-%v", tt.value, q.Start, q.End, tt.start, tt.end)
+		}
+	}
+}
+
+func TestQuietHoursUntil(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2024, 3, 10, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name  string
+		value string
+		now   time.Time
+		until time.Time
+		quiet bool
+	}{
+		{name: "none", value: "", now: at(3, 0)},
+		{name: "within", value: "01:00-06:00", now: at(3, 0), until: at(6, 0), quiet: true},
+		{name: "at end", value: "01:00-06:00", now: at(6, 0)},
+		{name: "over midnight before", value: "22:00-05:00", now: at(23, 0), until: at(5, 0).AddDate(0, 0, 1), quiet: true},
+		{name: "over midnight after", value: "22:00-05:00", now: at(4, 59), until: at(5, 0), quiet: true},
+		{name: "over midnight outside", value: "22:00-05:00", now: at(12, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuietHours(tt.value, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			until, quiet := q.Until(tt.now)
+			if quiet != tt.quiet || !until.Equal(tt.until) {
+				t.Errorf("Until(%v) = %v, %v, want %v, %v", tt.now, until, quiet, tt.until, tt.quiet)
+			}
+		})
+	}
+}
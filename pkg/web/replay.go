@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fixture is the metadata of a recorded response, the body is stored next to it in <key>.body
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// fixtureKey returns the file name (without extension) of the fixture for a request
+// The key only depends on the method, host, path and query, so the scheme may differ between recording and replay.
+func fixtureKey(method, host, pathAndQuery string) string {
+	sum := sha256.Sum256([]byte(method + " " + host + pathAndQuery))
+	return hex.EncodeToString(sum[:16])
+}
+
+// recorder is an http.RoundTripper saving every response to a fixture folder
+type recorder struct {
+	dir  string
+	next http.RoundTripper
+	mu   sync.Mutex
+}
+
+// NewRecorder returns a transport which sends requests using next and saves responses to dir
+func NewRecorder(dir string, next http.RoundTripper) (http.RoundTripper, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("error creating fixture folder %s: %w", dir, err)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &recorder{dir: dir, next: next}, nil
+}
+
+// RoundTrip sends the request and records the response
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the body to save it, then give the caller a fresh reader
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body of %s: %w", req.URL, err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := fixture{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+	}
+	key := fixtureKey(req.Method, req.URL.Host, req.URL.RequestURI())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	meta, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding fixture of %s: %w", req.URL, err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, key+".json"), meta, 0640); err != nil {
+		return nil, fmt.Errorf("error writing fixture of %s: %w", req.URL, err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, key+".body"), body, 0640); err != nil {
+		return nil, fmt.Errorf("error writing fixture body of %s: %w", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// NewReplayServer starts a local server answering with the responses recorded in dir.
+// Requests are expected in the form produced by NewReplayTransport: /<original host><original path and query>.
+// Unknown requests are answered with 404.
+func NewReplayServer(dir string) (*httptest.Server, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("error opening fixture folder %s: %w", dir, err)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Split "/cetatenie.just.ro/ordine-articolul-1-1/" into host and path
+		rest := strings.TrimPrefix(req.URL.RequestURI(), "/")
+		host, pathAndQuery, _ := strings.Cut(rest, "/")
+		key := fixtureKey(req.Method, host, "/"+pathAndQuery)
+
+		meta, err := os.ReadFile(filepath.Join(dir, key+".json"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("no fixture for %s %s", req.Method, rest), http.StatusNotFound)
+			return
+		}
+		var f fixture
+		if err := json.Unmarshal(meta, &f); err != nil {
+			http.Error(w, fmt.Sprintf("broken fixture for %s %s: %v", req.Method, rest, err), http.StatusInternalServerError)
+			return
+		}
+		body, err := os.ReadFile(filepath.Join(dir, key+".body"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("missing fixture body for %s %s: %v", req.Method, rest, err), http.StatusInternalServerError)
+			return
+		}
+
+		for k, values := range f.Header {
+			// The body is served as recorded, length and encoding are set by the server
+			if k == "Content-Length" || k == "Content-Encoding" || k == "Transfer-Encoding" {
+				continue
+			}
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+		w.WriteHeader(f.Status)
+		w.Write(body)
+	})
+
+	return httptest.NewServer(handler), nil
+}
+
+// replayTransport rewrites requests to the replay server
+type replayTransport struct {
+	server *httptest.Server
+}
+
+// NewReplayTransport returns a transport which sends every request to the replay server instead of the network
+func NewReplayTransport(server *httptest.Server) http.RoundTripper {
+	return &replayTransport{server: server}
+}
+
+// RoundTrip rewrites https://host/path?query to <server>/host/path?query
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := t.server.URL + "/" + req.URL.Host + req.URL.RequestURI()
+
+	out, err := http.NewRequestWithContext(req.Context(), req.Method, target, req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating replay request for %s: %w", req.URL, err)
+	}
+	out.Header = req.Header.Clone()
+
+	return t.server.Client().Transport.RoundTrip(out)
+}
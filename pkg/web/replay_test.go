@@ -0,0 +1,120 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	// Origin responses; the PDF isn't valid UTF-8 and has no trailing newline
+	pages := map[string]struct {
+		status      int
+		contentType string
+		body        []byte
+	}{
+		"/ordine/":          {status: http.StatusOK, contentType: "text/html; charset=utf-8", body: []byte("<ul><li><strong>26.10.2023</strong> Ștefan</li></ul>\n")},
+		"/ordine/?page=2":   {status: http.StatusOK, contentType: "text/html; charset=utf-8", body: []byte("<ul><li>page 2</li></ul>")},
+		"/o/1795.pdf":       {status: http.StatusOK, contentType: "application/pdf", body: []byte("%PDF-1.4\x00\xff\xfe\r\n%%EOF")},
+		"/o/removed.pdf":    {status: http.StatusNotFound, contentType: "text/plain", body: []byte("gone")},
+		"/ordine/empty.txt": {status: http.StatusOK, contentType: "text/plain", body: []byte{}},
+	}
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		page, ok := pages[req.URL.RequestURI()]
+		if !ok {
+			t.Errorf("unexpected origin request %s", req.URL)
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", page.contentType)
+		w.Header().Set("X-Origin", "recorded")
+		w.WriteHeader(page.status)
+		w.Write(page.body)
+	}))
+	host := strings.TrimPrefix(origin.URL, "http://")
+
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uri := range pages {
+		resp, err := (&http.Client{Transport: recorder}).Get(origin.URL + uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The recorder hands the body on to the caller
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !bytes.Equal(body, pages[uri].body) {
+			t.Errorf("recording %s: body %q, want %q", uri, body, pages[uri].body)
+		}
+	}
+
+	// Replay doesn't need the origin
+	origin.Close()
+	server, err := NewReplayServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client := &http.Client{Transport: NewReplayTransport(server)}
+
+	for uri, page := range pages {
+		// The scheme may differ from the recording
+		for _, scheme := range []string{"http://", "https://"} {
+			resp, err := client.Get(scheme + host + uri)
+			if err != nil {
+				t.Fatalf("replaying %s: %v", uri, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != page.status {
+				t.Errorf("replaying %s%s: status %d, want %d", scheme, uri, resp.StatusCode, page.status)
+			}
+			if !bytes.Equal(body, page.body) {
+				t.Errorf("replaying %s%s: body %q, want %q", scheme, uri, body, page.body)
+			}
+			if got := resp.Header.Get("Content-Type"); got != page.contentType {
+				t.Errorf("replaying %s%s: Content-Type %s, want %s", scheme, uri, got, page.contentType)
+			}
+			if got := resp.Header.Get("X-Origin"); got != "recorded" {
+				t.Errorf("replaying %s%s: X-Origin %q, want recorded", scheme, uri, got)
+			}
+		}
+	}
+
+	// Requests which weren't recorded fail instead of reaching the network
+	for _, target := range []string{origin.URL + "/ordine/?page=3", origin.URL + "/unknown", "https://example.com/ordine/"} {
+		resp, err := client.Get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("replaying unrecorded %s: status %d, want %d", target, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+
+	defer func(transport http.RoundTripper) { Transport = transport }(Transport)
+	Transport = NewReplayTransport(server)
+	defer SetPoliteness(currentPoliteness())
+	SetPoliteness(Politeness{})
+	if body, err := GetResponseBody(context.Background(), origin.URL+"/unknown"); err == nil {
+		t.Errorf("GetResponseBody of an unrecorded page = %q, want an error", body)
+	}
+	if body, err := GetResponseBody(context.Background(), origin.URL+"/ordine/"); err != nil || !bytes.Equal(body, pages["/ordine/"].body) {
+		t.Errorf("GetResponseBody of a recorded page = %q, %v", body, err)
+	}
+}
+
+func TestNewReplayServerMissingFolder(t *testing.T) {
+	if server, err := NewReplayServer(t.TempDir() + "/missing"); err == nil {
+		server.Close()
+		t.Error("NewReplayServer of a missing folder succeeded")
+	}
+}
@@ -0,0 +1,133 @@
+package web
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robots holds the robots.txt rules that apply to our user agent on one host
+type robots struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+	fetchedAt  time.Time
+	ttl        time.Duration
+}
+
+// robotsRule is one Allow or Disallow line
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// parseRobots reads robots.txt and keeps the group for agent, or the "*" group if there is none.
+// agent is the product token of the User-Agent, matched exactly and case-insensitively; a version after "/" in a
+// user-agent line is ignored.
+func parseRobots(r io.Reader, agent string) *robots {
+	agent = strings.ToLower(agent)
+
+	var (
+		specific, wildcard *robots
+		current            []*robots // groups the lines being read belong to
+		inAgents           bool      // reading consecutive user-agent lines
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+
+			name, _, _ := strings.Cut(strings.ToLower(value), "/")
+			name = strings.TrimSpace(name)
+			switch {
+			case name == "":
+				// An empty user-agent line names no crawler
+			case name == "*":
+				if wildcard == nil {
+					wildcard = &robots{}
+				}
+				current = append(current, wildcard)
+			case name == agent:
+				if specific == nil {
+					specific = &robots{}
+				}
+				current = append(current, specific)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, g := range current {
+			switch key {
+			case "allow", "disallow":
+				// An empty Disallow allows everything and adds no rule
+				if value != "" {
+					g.rules = append(g.rules, robotsRule{allow: key == "allow", pattern: value})
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					g.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case specific != nil:
+		return specific
+	case wildcard != nil:
+		return wildcard
+	}
+	return &robots{}
+}
+
+// allowed reports whether path (with query) may be fetched: the longest matching rule wins, Allow wins ties
+func (r *robots) allowed(path string) bool {
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !matchRobots(rule.pattern, path) {
+			continue
+		}
+		if n := len(rule.pattern); n > best || (n == best && rule.allow) {
+			best, allow = n, rule.allow
+		}
+	}
+	return allow
+}
+
+// matchRobots matches a robots.txt path pattern with "*" wildcards and a "$" end anchor against path
+func matchRobots(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		// The last part of an anchored pattern must end the path
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,107 @@
+package web
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name       string
+		robots     string
+		path       string
+		allowed    bool
+		crawlDelay time.Duration
+	}{
+		{
+			name:    "no rules",
+			robots:  "",
+			path:    "/orders/1.pdf",
+			allowed: true,
+		},
+		{
+			name:       "wildcard group",
+			robots:     "User-agent: *\nDisallow: /private\nCrawl-delay: 2",
+			path:       "/private/a",
+			allowed:    false,
+			crawlDelay: 2 * time.Second,
+		},
+		{
+			name:    "own group wins over wildcard",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: RomaniaBot\nDisallow: /tmp",
+			path:    "/orders/1.pdf",
+			allowed: true,
+		},
+		{
+			name:    "version in user-agent line is ignored",
+			robots:  "User-agent: *\nDisallow: /\n\nUser-agent: romaniabot/2.0\nAllow: /",
+			path:    "/orders/1.pdf",
+			allowed: true,
+		},
+		{
+			name:    "prefix of our token is another crawler",
+			robots:  "User-agent: *\nAllow: /\n\nUser-agent: romania\nDisallow: /",
+			path:    "/orders/1.pdf",
+			allowed: true,
+		},
+		{
+			name:    "empty user-agent names no crawler",
+			robots:  "User-agent: *\nAllow: /\n\nUser-agent:\nDisallow: /",
+			path:    "/orders/1.pdf",
+			allowed: true,
+		},
+		{
+			name:    "consecutive user-agent lines share a group",
+			robots:  "User-agent: other\nUser-agent: romaniabot\nDisallow: /orders",
+			path:    "/orders/1.pdf",
+			allowed: false,
+		},
+		{
+			name:    "longest rule wins",
+			robots:  "User-agent: *\nDisallow: /orders\nAllow: /orders/public",
+			path:    "/orders/public/1.pdf",
+			allowed: true,
+		},
+		{
+			name:    "comments are ignored",
+			robots:  "User-agent: * # everyone\nDisallow: /orders # no orders",
+			path:    "/orders/1.pdf",
+			allowed: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := parseRobots(strings.NewReader(tt.robots), "romaniabot")
+			if got := r.allowed(tt.path); got != tt.allowed {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+			}
+			if r.crawlDelay != tt.crawlDelay {
+				t.Errorf("crawl delay = %v, want %v", r.crawlDelay, tt.crawlDelay)
+			}
+		})
+	}
+}
+
+func TestMatchRobots(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/orders", "/orders/1.pdf", true},
+		{"/orders", "/order", false},
+		{"/*.pdf", "/orders/1.pdf", true},
+		{"/*.pdf$", "/orders/1.pdf", true},
+		{"/*.pdf$", "/orders/1.pdf?x=1", false},
+		{"/orders$", "/orders", true},
+		{"/orders$", "/orders/", false},
+		{"/a*b*c", "/a-b-c-d", true},
+		{"/a*c*b", "/a-b-c", false},
+	}
+	for _, tt := range tests {
+		if got := matchRobots(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRobots(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -1,54 +1,61 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
 )
 
+// Transport is used by every outbound request of the bot.
+// It is replaced by Configure, and by a recording or replaying transport in record and replay modes.
+var Transport http.RoundTripper = http.DefaultTransport
+
+// UserAgent identifies the bot in every outbound request
+var UserAgent = "RomanianBot/1.0"
+
+// Timeout limits page requests; zero means no timeout
+var Timeout time.Duration
+
 // GetResponseBody makes an HTTP GET request to the specified URL and returns the response body as a byte slice.
-func GetResponseBody(url string) ([]byte, error) {
-    // Create a new GET request with the specified URL
-    req, err := http.NewRequest("GET", url, nil)
-    if err != nil {
-        return nil, fmt.Errorf("error creating request: %w", err)
-    }
-    
-    // Set the User-Agent header to identify the client
-    req.Header.Set("User-Agent", "RomanianBot/1.0")
-    
-    // Send the request using the default HTTP client
-    client := http.DefaultClient
-    resp, err := client.Do(req)
-    if err != nil {
-        return nil, fmt.Errorf("error connecting to %s: %w", url, err)
-    }
-    
-    // Close the response body after reading all the data
-    defer resp.Body.Close()
-    
-    // Read the response body and return it as a byte slice
-    return io.ReadAll(resp.Body)
-}
+// A response with a non-2xx status is returned as an error, so error pages aren't taken for the requested page.
+func GetResponseBody(ctx context.Context, url string) ([]byte, error) {
+	// Create a new GET request with the specified URL
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
 
-// Ping checks the availability of a resource and returns the status code and error.
-func Ping(url string, timeout time.Duration) (int, error) {
-	// Create a new HTTP client with the specified timeout
-	client := &http.Client{
-		Timeout: timeout,
+	// Send the request using the shared crawl client
+	resp, err := NewCrawlClient(Timeout).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", url, err)
 	}
 
+	// Close the response body after reading all the data
+	defer resp.Body.Close()
+
+	// Rate limit, outage and not found pages aren't the requested page
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	// Read the response body and return it as a byte slice
+	return io.ReadAll(resp.Body)
+}
+
+// Ping checks the availability of a resource and returns the status code and error.
+func Ping(ctx context.Context, url string, timeout time.Duration) (int, error) {
 	// Create a new HTTP HEAD request to the specified URL
-	req, err := http.NewRequest("HEAD", url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
 	if err != nil {
 		// Return an error if there was an issue creating the request
 		return 0, fmt.Errorf("error creating request: %w", err)
 	}
-	req.Header.Set("User-Agent", "RomanianBot/1.0")
 
-	// Send the request and get the response
-	resp, err := client.Do(req)
+	// Send the request with the specified timeout and get the response
+	resp, err := NewCrawlClient(timeout).Do(req)
 	if err != nil {
 		// Return an error if there was an issue connecting to the URL
 		return 0, fmt.Errorf("error connecting to %s: %w", url, err)
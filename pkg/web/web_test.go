@@ -0,0 +1,45 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetResponseBody(t *testing.T) {
+	// Answers /<status> with that status
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		status, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/"))
+		w.WriteHeader(status)
+		w.Write([]byte("page " + req.URL.Path))
+	}))
+	defer server.Close()
+	defer SetPoliteness(currentPoliteness())
+	SetPoliteness(Politeness{})
+
+	tests := []struct {
+		status  int
+		wantErr bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusNotFound, wantErr: true},
+		{status: http.StatusTooManyRequests, wantErr: true},
+		{status: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		body, err := GetResponseBody(context.Background(), server.URL+"/"+strconv.Itoa(tt.status))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("status %d: body %q, want an error", tt.status, body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("status %d: %v", tt.status, err)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/web"
+)
+
+// Event types sent to webhooks
+const (
+	EventOrderFileDiscovered = "order_file.discovered"
+	EventOrderFileDownloaded = "order_file.downloaded"
+	EventOrderFileParsed     = "order_file.parsed"
+	EventDossierMatched      = "dossier.matched"
+)
+
+// Events lists all event types a webhook can subscribe to
+var Events = []string{EventOrderFileDiscovered, EventOrderFileDownloaded, EventOrderFileParsed, EventDossierMatched}
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	// MaxAttempts is the number of delivery attempts before a delivery is marked as failed
+	MaxAttempts = 6
+	// firstBackoff is the delay after the first failed attempt, doubled after each next one
+	firstBackoff = 30 * time.Second
+	timeout      = 10 * time.Second
+)
+
+// Payload is the JSON body posted to webhooks
+type Payload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+// OrderFileData is the data of order_file.* events
+type OrderFileData struct {
+	Filename string `json:"filename"`
+	Date     string `json:"date"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	Source   string `json:"source,omitempty"`
+	Dossiers *int   `json:"dossiers,omitempty"` // only for order_file.parsed
+}
+
+// DossierData is the data of dossier.matched events
+type DossierData struct {
+	Dossier  string `json:"dossier"`
+	Number   uint   `json:"number"`
+	Year     uint   `json:"year"`
+	Filename string `json:"filename"`
+}
+
+// Sign returns the signature sent in the X-Romaniabot-Signature header: "sha256=" + hex(HMAC-SHA256(secret, body))
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckURL returns an error unless raw is an http or https URL with a host
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook URL %q, expected an http:// or https:// URL", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q, no host", raw)
+	}
+	return nil
+}
+
+// Subscribed reports whether a comma separated event list contains event
+func Subscribed(events, event string) bool {
+	for _, e := range strings.Split(events, ",") {
+		e = strings.TrimSpace(e)
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Emit stores a delivery of the event for every active webhook subscribed to it.
+// Deliveries are sent by Flush.
+func Emit(ctx context.Context, db *sql.DB, event string, data any) error {
+	rows, err := db.QueryContext(ctx, model.Get_Active_Webhooks)
+	if err != nil {
+		return fmt.Errorf("error reading webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := make([]model.Webhook, 0)
+	for rows.Next() {
+		var h model.Webhook
+		if err := rows.Scan(&h.ID, &h.URL, &h.Secret, &h.Events, &h.IsActive, &h.CreatedAt); err != nil {
+			return fmt.Errorf("error scanning webhook: %w", err)
+		}
+		if Subscribed(h.Events, event) {
+			hooks = append(hooks, h)
+		}
+	}
+	rows.Close()
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	payload, err := json.Marshal(Payload{Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return fmt.Errorf("error encoding %s payload: %w", event, err)
+	}
+
+	for _, h := range hooks {
+		_, err := db.ExecContext(ctx, model.Insert_Webhook_Delivery, h.ID, event, string(payload), now)
+		if err != nil {
+			return fmt.Errorf("error storing %s delivery for webhook %d: %w", event, h.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// Flush sends all pending deliveries which are due and records the results.
+// Failed deliveries are retried by later flushes with exponential backoff until MaxAttempts is reached.
+// Returns the number of delivered and failed attempts.
+func Flush(ctx context.Context, db *sql.DB) (delivered, failed int, err error) {
+	deliveries, err := queryDeliveries(ctx, db, model.Get_Due_Webhook_Deliveries, time.Now().UTC())
+	if err != nil {
+		return 0, 0, err
+	}
+
+	client := web.NewClient(timeout)
+	for _, d := range deliveries {
+		if ctx.Err() != nil {
+			return delivered, failed, ctx.Err()
+		}
+
+		status, sendErr := send(ctx, client, d)
+		if err := record(ctx, db, d, status, sendErr); err != nil {
+			return delivered, failed, err
+		}
+		if sendErr != nil {
+			failed++
+		} else {
+			delivered++
+		}
+	}
+
+	return delivered, failed, nil
+}
+
+// Replay resets a delivery to pending so the next Flush sends it again, whatever its current status
+func Replay(ctx context.Context, db *sql.DB, id int64) error {
+	res, err := db.ExecContext(ctx, model.Set_Webhook_Delivery_pending, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("error resetting delivery %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("delivery %d not found", id)
+	}
+	return nil
+}
+
+// Deliveries returns the latest deliveries, newest first
+func Deliveries(ctx context.Context, db *sql.DB, limit int) ([]model.WebhookDelivery, error) {
+	return queryDeliveries(ctx, db, model.Get_Webhook_Deliveries, limit)
+}
+
+// queryDeliveries reads deliveries selected with the WebhookDeliveries column list
+func queryDeliveries(ctx context.Context, db *sql.DB, query string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		var d model.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseStatus,
+			&d.LastError, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// send posts a delivery and returns the response status; any non-2xx status is an error
+func send(ctx context.Context, client *http.Client, d model.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Romaniabot-Event", d.Event)
+	req.Header.Set("X-Romaniabot-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Romaniabot-Signature", Sign(d.Secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error connecting to %s: %w", d.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, d.URL)
+	}
+	return resp.StatusCode, nil
+}
+
+// record saves the result of an attempt and schedules the next one
+func record(ctx context.Context, db *sql.DB, d model.WebhookDelivery, responseStatus int, sendErr error) error {
+	status := StatusDelivered
+	lastError := ""
+	next := d.NextAttemptAt
+
+	if sendErr != nil {
+		lastError = sendErr.Error()
+		attempts := d.Attempts + 1
+		if attempts >= MaxAttempts {
+			status = StatusFailed
+		} else {
+			status = StatusPending
+			next = time.Now().UTC().Add(backoff(attempts))
+		}
+	}
+
+	_, err := db.ExecContext(ctx, model.Set_Webhook_Delivery_Result, status, responseStatus, lastError, next, status, d.ID)
+	if err != nil {
+		return fmt.Errorf("error recording delivery %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+// backoff returns the delay after the given number of failed attempts: firstBackoff doubled after each attempt
+// but the first
+func backoff(attempts int) time.Duration {
+	return firstBackoff << (attempts - 1)
+}
@@ -0,0 +1,206 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"romaniabot/model"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret, body, want string
+	}{
+		// RFC 4231, test case 2
+		{secret: "Jefe", body: "what do ya want for nothing?", want: "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{secret: "", body: "", want: "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %q) = %s, want %s", tt.secret, tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://hooks.example.com/romaniabot"},
+		{url: "http://localhost:8080/hook?token=x"},
+		{url: "", wantErr: true},
+		{url: "hooks.example.com/romaniabot", wantErr: true},
+		{url: "/romaniabot", wantErr: true},
+		{url: "ftp://hooks.example.com/romaniabot", wantErr: true},
+		{url: "https://", wantErr: true},
+		{url: "https://hooks.example.com/%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		err := CheckURL(tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckURL(%q) = %v, want error %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: MaxAttempts - 1, want: 8 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// receiver is a webhook endpoint answering with the queued statuses, then 204
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	body, _ := io.ReadAll(req.Body)
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would open its own in-memory database
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := model.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every attempt fails, the replayed one succeeds
+	rcv := &receiver{}
+	for i := 0; i < MaxAttempts; i++ {
+		rcv.statuses = append(rcv.statuses, http.StatusServiceUnavailable)
+	}
+	server := httptest.NewServer(rcv)
+	defer server.Close()
+
+	if _, err := db.Exec(model.Insert_Webhook, server.URL, "s3cret", EventDossierMatched); err != nil {
+		t.Fatal(err)
+	}
+	if err := Emit(ctx, db, EventOrderFileParsed, OrderFileData{Filename: "ignored.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Emit(ctx, db, EventDossierMatched, DossierData{Dossier: "12345/2019", Number: 12345, Year: 2019, Filename: "ordin.pdf"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// delivery returns the only delivery, which isn't stored for the unsubscribed event
+	delivery := func() model.WebhookDelivery {
+		t.Helper()
+		deliveries, err := Deliveries(ctx, db, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("%d deliveries, want 1", len(deliveries))
+		}
+		return deliveries[0]
+	}
+	id := delivery().ID
+
+	// flush sends the delivery, made due first
+	flush := func(wantDelivered, wantFailed int) {
+		t.Helper()
+		if _, err := db.Exec(`UPDATE WebhookDeliveries SET NextAttemptAt = ? WHERE ID = ?`, time.Now().UTC().Add(-time.Second), id); err != nil {
+			t.Fatal(err)
+		}
+		delivered, failed, err := Flush(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivered != wantDelivered || failed != wantFailed {
+			t.Fatalf("Flush = %d delivered, %d failed, want %d, %d", delivered, failed, wantDelivered, wantFailed)
+		}
+	}
+
+	for attempts := 1; attempts <= MaxAttempts; attempts++ {
+		before := time.Now().UTC()
+		flush(0, 1)
+		d := delivery()
+		if d.Attempts != attempts || d.ResponseStatus != http.StatusServiceUnavailable || d.LastError == "" {
+			t.Errorf("attempt %d: attempts %d, response status %d, last error %q", attempts, d.Attempts, d.ResponseStatus, d.LastError)
+		}
+		if attempts == MaxAttempts {
+			if d.Status != StatusFailed {
+				t.Errorf("attempt %d: status %s, want %s", attempts, d.Status, StatusFailed)
+			}
+			break
+		}
+		if d.Status != StatusPending {
+			t.Errorf("attempt %d: status %s, want %s", attempts, d.Status, StatusPending)
+		}
+		// The next attempt waits for the backoff
+		if wait := d.NextAttemptAt.Sub(before); wait < backoff(attempts) || wait > backoff(attempts)+time.Minute {
+			t.Errorf("attempt %d: next attempt in %v, want %v", attempts, wait, backoff(attempts))
+		}
+		if delivered, failed, _ := Flush(ctx, db); delivered+failed != 0 {
+			t.Errorf("attempt %d: delivery sent again before its backoff", attempts)
+		}
+	}
+
+	// A failed delivery is only sent again once replayed
+	flush(0, 0)
+	if err := Replay(ctx, db, id); err != nil {
+		t.Fatal(err)
+	}
+	flush(1, 0)
+	if d := delivery(); d.Status != StatusDelivered || d.ResponseStatus != http.StatusNoContent || d.LastError != "" {
+		t.Errorf("replayed delivery: status %s, response status %d, last error %q", d.Status, d.ResponseStatus, d.LastError)
+	}
+	if err := Replay(ctx, db, id+1); err == nil {
+		t.Error("replaying a missing delivery succeeded")
+	}
+
+	// Every attempt posts the same signed payload
+	if len(rcv.requests) != MaxAttempts+1 {
+		t.Fatalf("%d requests, want %d", len(rcv.requests), MaxAttempts+1)
+	}
+	for i, req := range rcv.requests {
+		if got, want := req.Header.Get("X-Romaniabot-Signature"), Sign("s3cret", rcv.bodies[i]); got != want {
+			t.Errorf("request %d: signature %s, want %s", i, got, want)
+		}
+		if got := req.Header.Get("X-Romaniabot-Event"); got != EventDossierMatched {
+			t.Errorf("request %d: event %s, want %s", i, got, EventDossierMatched)
+		}
+		if string(rcv.bodies[i]) != string(rcv.bodies[0]) {
+			t.Errorf("request %d: body %s, want %s", i, rcv.bodies[i], rcv.bodies[0])
+		}
+	}
+}
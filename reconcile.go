@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"romaniabot/model"
+	"romaniabot/pkg/fileutil"
+	"romaniabot/pkg/jobs"
+	"romaniabot/pkg/pipeline"
+)
+
+// Problems found by reconcile
+const (
+	problemOrphan       = "orphan"        // file without order file row
+	problemMissing      = "missing"       // downloaded order file without file
+	problemEmpty        = "empty"         // zero-byte file
+	problemNotPDF       = "not_pdf"       // file without PDF header
+	problemTruncated    = "truncated"     // file without PDF end-of-file marker
+	problemHashMismatch = "hash_mismatch" // file changed since it was downloaded
+	problemUntracked    = "untracked"     // complete file of an order file which isn't downloaded yet
+	problemUnhashed     = "unhashed"      // downloaded order file without stored hash
+)
+
+// problems lists the problems in report order
+var problems = []string{problemOrphan, problemMissing, problemEmpty, problemNotPDF, problemTruncated,
+	problemHashMismatch, problemUntracked, problemUnhashed}
+
+// orphansFolder is the subfolder of the orders folder orphan files are moved to
+const orphansFolder = "orphans"
+
+// reconcileRow is an order file as read by reconcile
+type reconcileRow struct {
+	filename string
+	state    model.State
+	hash     string
+	size     int64
+	queued   bool // has a pending or running job
+}
+
+// Reconcile compares the orders folder with the database in both directions and reports the problems found,
+// one per line: problem, filename, detail and the fix applied with -fix.
+// Usage: reconcile [-fix]
+// With -fix, orphan files are moved to the orphans subfolder, damaged files are deleted, downloaded order files
+// with a missing or damaged file are queued for download again, untracked files are marked as downloaded and
+// missing hashes are recorded. Order files with a pending or running job are skipped.
+// Problems are returned as a *pipeline.Errors, with -fix only those which couldn't be fixed.
+func Reconcile(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	fix := flags.Bool("fix", false, "fix the problems found")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	rows, err := reconcileRows(db)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		known[row.filename] = true
+	}
+
+	// Files in the orders folder; subfolders, like the orphans folder, are not order files
+	entries, err := os.ReadDir(cfg.Storage.OrdersPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error reading orders folder: %w", err)
+	}
+	inFolder := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			inFolder[entry.Name()] = true
+		}
+	}
+
+	var failed pipeline.Errors
+	counts := make(map[string]int)
+	report := func(problem, filename, detail string, fixFn func() (string, error)) {
+		counts[problem]++
+		action := "-"
+		if *fix {
+			var err error
+			action, err = fixFn()
+			if err != nil {
+				action = "fix failed: " + err.Error()
+				failed.Add(pipeline.FileError(filename, fmt.Errorf("%s: %w", problem, err)))
+			}
+		} else {
+			failed.Add(pipeline.FileError(filename, errors.New(problem+": "+detail)))
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", problem, filename, detail, action)
+	}
+
+	// Files without order file row
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if known[name] {
+			continue
+		}
+		report(problemOrphan, name, "no order file in DB", func() (string, error) {
+			return "moved to " + orphansFolder, moveOrphan(name)
+		})
+	}
+
+	for _, row := range rows {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Work in progress, its job owns the file
+		if row.queued {
+			continue
+		}
+		path := filepath.Join(cfg.Storage.OrdersPath, row.filename)
+
+		switch row.state {
+
+		case model.StateDownloaded, model.StateParsed, model.StateNeedsOCR:
+			if !inFolder[row.filename] {
+				report(problemMissing, row.filename, "no file in orders folder", func() (string, error) {
+					return "queued for download", requeueDownload(ctx, db, row.filename, problemMissing)
+				})
+				continue
+			}
+			if err := fileutil.CheckPDF(path); err != nil {
+				report(pdfProblem(err), row.filename, err.Error(), func() (string, error) {
+					if err := os.Remove(path); err != nil {
+						return "", err
+					}
+					return "deleted, queued for download", requeueDownload(ctx, db, row.filename, pdfProblem(err))
+				})
+				continue
+			}
+			hash, size, err := fileutil.HashFile(path)
+			if err != nil {
+				failed.Add(pipeline.FileError(row.filename, err))
+				continue
+			}
+			switch {
+			case row.hash == "":
+				report(problemUnhashed, row.filename, fmt.Sprintf("%d bytes", size), func() (string, error) {
+					return "hash recorded", recordFileHash(ctx, db, row.filename)
+				})
+			case row.hash != hash || row.size != size:
+				detail := fmt.Sprintf("%d bytes, expected %d bytes with SHA-256 %s", size, row.size, row.hash)
+				report(problemHashMismatch, row.filename, detail, func() (string, error) {
+					if err := os.Remove(path); err != nil {
+						return "", err
+					}
+					return "deleted, queued for download", requeueDownload(ctx, db, row.filename, problemHashMismatch)
+				})
+			}
+
+		case model.StateDiscovered, model.StateVerified, model.StateBroken:
+			// Failed order files are left to their jobs, see the jobs command
+			if !inFolder[row.filename] {
+				continue
+			}
+			if err := fileutil.CheckPDF(path); err != nil {
+				report(pdfProblem(err), row.filename, err.Error(), func() (string, error) {
+					return "deleted", os.Remove(path)
+				})
+				continue
+			}
+			report(problemUntracked, row.filename, "file in orders folder, state "+string(row.state), func() (string, error) {
+				if err := recordFileHash(ctx, db, row.filename); err != nil {
+					return "", err
+				}
+				return "marked as downloaded", model.SetState(ctx, db, row.filename, model.StateDownloaded, "found in orders folder by reconcile")
+			})
+		}
+	}
+
+	found := 0
+	for _, problem := range problems {
+		if counts[problem] > 0 {
+			found += counts[problem]
+			slog.Info("Reconcile problems", "problem", problem, "count", counts[problem])
+		}
+	}
+	slog.Info("Reconcile finished", "order_files", len(rows), "files", len(inFolder), "problems", found,
+		"fixed", *fix, "unresolved", len(failed.Items))
+	return failed.Err()
+}
+
+// reconcileRows reads all order files sorted by filename
+func reconcileRows(db *sql.DB) ([]reconcileRow, error) {
+	rows, err := db.Query(model.Get_Order_Files_to_reconcile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading order files: %w", err)
+	}
+	defer rows.Close()
+
+	result := make([]reconcileRow, 0)
+	for rows.Next() {
+		var r reconcileRow
+		if err := rows.Scan(&r.filename, &r.state, &r.hash, &r.size, &r.queued); err != nil {
+			return nil, fmt.Errorf("error scanning order file: %w", err)
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// pdfProblem returns the problem reported for a CheckPDF error
+func pdfProblem(err error) string {
+	switch {
+	case errors.Is(err, fileutil.ErrEmptyFile):
+		return problemEmpty
+	case errors.Is(err, fileutil.ErrNotPDF):
+		return problemNotPDF
+	}
+	return problemTruncated
+}
+
+// requeueDownload moves an order file to the failed state and queues it for download
+func requeueDownload(ctx context.Context, db *sql.DB, filename, problem string) error {
+	if err := model.SetState(ctx, db, filename, model.StateFailed, "reconcile: "+problem); err != nil {
+		return err
+	}
+	return jobs.Requeue(ctx, db, jobs.KindDownload, filename)
+}
+
+// moveOrphan moves a file without order file row to the orphans subfolder of the orders folder
+func moveOrphan(name string) error {
+	dir := filepath.Join(cfg.Storage.OrdersPath, orphansFolder)
+	if err := fileutil.CheckDir(dir); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(cfg.Storage.OrdersPath, name), filepath.Join(dir, name))
+}
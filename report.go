@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+
+	"romaniabot/pkg/report"
+)
+
+// Report writes the community report to a folder: SVG charts of orders and dossiers per month, the processing front
+// per dossier year and processing time percentiles, with an index.html showing them. The folder is self-contained,
+// and serve and daemon host storage.reportsPath under /report/.
+// Usage: report [-out dir] [-months n] [-cohorts n], storage.reportsPath from the config by default
+func Report(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	out := flags.String("out", cfg.Storage.ReportsPath, "folder the report is written to")
+	months := flags.Int("months", report.DefaultMonths, "months charted, up to the month of the latest order")
+	cohorts := flags.Int("cohorts", report.DefaultCohorts, "most recent dossier years in the processing front chart")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *months < 1 || *cohorts < 1 {
+		return fmt.Errorf("invalid report options: -months and -cohorts must be positive")
+	}
+
+	files, err := report.Generate(ctx, db, *out, report.Options{Months: *months, Cohorts: *cohorts})
+	if err != nil {
+		return err
+	}
+	slog.Info("Report generated", "dir", *out, "files", len(files))
+	fmt.Println(filepath.Join(*out, report.IndexFile))
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"romaniabot/model"
+	"romaniabot/pkg/extractors"
+	"romaniabot/pkg/pipeline"
+)
+
+// Search prints the order file pages matching a full-text query, one per line: filename, page, order name, order
+// date and a snippet with the matched terms in [brackets]. Words match as prefixes, "quoted text" as a phrase
+// ending with a prefix.
+// Usage: search [-limit n] [-reindex] <query>
+// With -reindex, the text of parsed order files which aren't indexed yet is extracted first, e.g. after an upgrade.
+func Search(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "maximum number of pages printed")
+	reindex := flags.Bool("reindex", false, "index the text of parsed order files which aren't indexed yet")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *reindex {
+		if err := indexPages(ctx, db); err != nil {
+			return err
+		}
+	}
+
+	query := strings.Join(flags.Args(), " ")
+	if query == "" {
+		if *reindex {
+			return nil
+		}
+		return usageError("usage: search [-limit n] [-reindex] <query>")
+	}
+
+	hits, total, err := model.Search(ctx, db, query, *limit, 0)
+	if err != nil {
+		return err
+	}
+	highlight := strings.NewReplacer(model.HighlightStart, "[", model.HighlightEnd, "]")
+	for _, hit := range hits {
+		orderDate := "-"
+		if !hit.OrderDate.IsZero() {
+			orderDate = hit.OrderDate.Format("2006-01-02")
+		}
+		fmt.Printf("%s\tpage %d\t%s\t%s\t%s\n", hit.Filename, hit.Page, hit.Name, orderDate, highlight.Replace(hit.Snippet))
+	}
+	slog.Info("Search finished", "query", query, "pages", total, "printed", len(hits))
+	return nil
+}
+
+// indexPages extracts and indexes the page text of parsed order files which have none
+func indexPages(ctx context.Context, db *sql.DB) error {
+	filenames, err := queryStrings(db, model.Get_Files_to_index)
+	if err != nil {
+		return fmt.Errorf("error reading order files to index: %w", err)
+	}
+
+	var failed pipeline.Errors
+	for _, filename := range filenames {
+		if ctx.Err() != nil {
+			return errors.Join(ctx.Err(), failed.Err())
+		}
+		_, pages, err := extractors.Parse(cfg.Storage.OrdersPath, filename)
+		if err == nil {
+			err = model.SavePages(ctx, db, filename, pages)
+		}
+		if err != nil {
+			slog.Error("Order file indexing error", "file", filename, "error", err)
+			failed.Add(pipeline.FileError(filename, err))
+			continue
+		}
+		slog.Info("Order file indexed", "file", filename, "pages", len(pages))
+	}
+	slog.Info("Indexing finished", "files", len(filenames), "failed", len(failed.Items))
+	return failed.Err()
+}
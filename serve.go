@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"romaniabot/pkg/api"
+	"romaniabot/pkg/report"
+)
+
+// Serve runs the read-only HTTP API, with the report written by the report command under /report/, until interrupted
+// Usage: serve [-addr addr], server.addr from the config by default
+// Returns an error if the HTTP server fails.
+func Serve(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", cfg.Server.Addr, "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := createBlobFolders(); err != nil {
+		return err
+	}
+
+	handler := api.NewServer(db, cfg.Storage.OrdersPath, cfg.Storage.SnapshotsPath)
+	handler.Handle("/report/", http.StripPrefix("/report/", report.Handler(cfg.Storage.ReportsPath)))
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	// Interrupting the process shuts the server down, letting running requests finish
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving API", "addr", *addr)
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("HTTP server error: %w", err)
+	}
+	slog.Info("Shutting down")
+	<-shutdown
+	return nil
+}
+
+// createBlobFolders creates the orders and snapshots folders, which otherwise only appear with the first download
+// or scrape, so /healthz reports a fresh install as healthy
+func createBlobFolders() error {
+	for _, dir := range []string{cfg.Storage.OrdersPath, cfg.Storage.SnapshotsPath} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return fmt.Errorf("error creating folder %s: %w", dir, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/extractors"
+	"romaniabot/pkg/snapshots"
+)
+
+// archiveSnapshot stores the listing body if it differs from the last stored snapshot of the source
+func archiveSnapshot(ctx context.Context, db *sql.DB, source string, body []byte) error {
+	hash := snapshots.Hash(body)
+
+	// Compare with the previous snapshot
+	var lastHash string
+	err := db.QueryRowContext(ctx, model.Get_Last_Snapshot_Hash, source).Scan(&lastHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("error reading last snapshot: %w", err)
+	}
+	if lastHash == hash {
+		return nil
+	}
+
+	fetchedAt := time.Now().UTC()
+	path, err := snapshots.Save(cfg.Storage.SnapshotsPath, source, fetchedAt, body)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, model.Insert_Snapshot, source, fetchedAt, hash, path, len(body))
+	if err != nil {
+		return fmt.Errorf("error during insert snapshot in db %s: %w", path, err)
+	}
+
+	slog.InfoContext(ctx, "Listing snapshot saved", "path", path, "url", source)
+	return nil
+}
+
+// getSnapshot reads a snapshot row by ID
+func getSnapshot(db *sql.DB, id int64) (model.Snapshot, error) {
+	var s model.Snapshot
+	err := db.QueryRow(model.Get_Snapshot_by_ID, id).Scan(&s.ID, &s.Source, &s.FetchedAt, &s.Hash, &s.Path, &s.Size)
+	if err != nil {
+		return s, fmt.Errorf("error reading snapshot %d: %w", id, err)
+	}
+	return s, nil
+}
+
+// loadSnapshotListing reads a snapshot from disk and parses it as a listing page
+func loadSnapshotListing(db *sql.DB, id int64) (extractors.Listing, error) {
+	s, err := getSnapshot(db, id)
+	if err != nil {
+		return extractors.Listing{}, err
+	}
+	body, err := snapshots.Load(s.Path)
+	if err != nil {
+		return extractors.Listing{}, err
+	}
+	base, err := url.Parse(s.Source)
+	if err != nil {
+		return extractors.Listing{}, fmt.Errorf("error parsing listing URL of snapshot %d: %w", id, err)
+	}
+	return extractors.ParseListing(bytes.NewReader(body), base)
+}
+
+// Scrape fetches the listing pages, or re-runs extraction from a stored snapshot with -snapshot <id>
+func Scrape(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	snapshotID := flags.Int64("snapshot", 0, "re-run extraction offline from the stored snapshot with this ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *snapshotID == 0 {
+		return LiTagsExtractor(ctx, db)
+	}
+
+	s, err := getSnapshot(db, *snapshotID)
+	if err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+	body, err := snapshots.Load(s.Path)
+	if err != nil {
+		return fmt.Errorf("error loading snapshot: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Extracting from snapshot", "snapshot", s.ID, "url", s.Source, "fetched_at", s.FetchedAt.Format(time.RFC3339))
+	return saveListing(ctx, db, s.Source, body)
+}
+
+// Snapshots prints all stored listing snapshots
+func Snapshots(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, model.Get_Snapshots)
+	if err != nil {
+		return fmt.Errorf("error reading snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s model.Snapshot
+		err = rows.Scan(&s.ID, &s.Source, &s.FetchedAt, &s.Hash, &s.Path, &s.Size)
+		if err != nil {
+			return fmt.Errorf("error scanning snapshot: %w", err)
+		}
+		fmt.Printf("%d\t%s\t%s\t%d\t%s\n", s.ID, s.FetchedAt.Format(time.RFC3339), s.Source, s.Size, s.Hash[:12])
+	}
+	return rows.Err()
+}
+
+// SnapshotDiff prints the order entries added, removed and changed between two snapshots
+// Usage: snapshot-diff <old id> <new id>
+func SnapshotDiff(ctx context.Context, db *sql.DB, args []string) error {
+	if len(args) != 2 {
+		return usageError("usage: snapshot-diff <old id> <new id>")
+	}
+
+	ids := make([]int64, 2)
+	for i, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid snapshot ID %q", arg))
+		}
+		ids[i] = id
+	}
+
+	prev, err := loadSnapshotListing(db, ids[0])
+	if err != nil {
+		return err
+	}
+	next, err := loadSnapshotListing(db, ids[1])
+	if err != nil {
+		return err
+	}
+
+	added, removed, changed := extractors.DiffListings(prev, next)
+	for _, el := range added {
+		fmt.Printf("+ %s\t%s\t%s\n", el.Date, el.Name, el.URL)
+	}
+	for _, el := range removed {
+		fmt.Printf("- %s\t%s\t%s\n", el.Date, el.Name, el.URL)
+	}
+	for _, el := range changed {
+		fmt.Printf("~ %s\t%s\t%s\n", el.Date, el.Name, el.URL)
+	}
+
+	slog.Info("Snapshots compared", "added", len(added), "removed", len(removed), "changed", len(changed))
+	return nil
+}
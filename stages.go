@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/pipeline"
+)
+
+// Pipeline stage names recorded in StageRuns
+const (
+	stageScrape   = "scrape"
+	stageCheck    = "check"
+	stageDownload = "download"
+	stageParse    = "parse"
+	stageWebhooks = "webhooks"
+)
+
+// Process exit codes
+const (
+	exitOK       = 0 // all stages completed without errors
+	exitFailed   = 1 // a stage failed or the command couldn't start
+	exitUsage    = 2 // unknown command or bad arguments
+	exitPartial  = 3 // all stages completed, but some files or URLs failed
+	exitNotFound = 4 // the dossier looked up isn't in any parsed order
+)
+
+// runID identifies the current pipeline run in StageRuns; a new one is generated for every daemon run
+var runID = newRunID()
+
+// newRunID returns a random run ID
+func newRunID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stage runs fn as a pipeline stage, logging and recording its start, finish and errors.
+// Records logged with the context passed to fn carry the run ID and the stage name.
+// Returns the error of fn as a *pipeline.StageError.
+func stage(ctx context.Context, db *sql.DB, name string, fn func(ctx context.Context) error) error {
+	ctx = withLogAttrs(ctx, slog.String("run", runID), slog.String("stage", name))
+
+	var id int64
+	res, err := db.Exec(model.Insert_Stage_Run, runID, name, time.Now().UTC())
+	if err != nil {
+		slog.ErrorContext(ctx, "Stage run recording error", "error", err)
+	} else {
+		id, _ = res.LastInsertId()
+	}
+
+	stageErr := fn(ctx)
+
+	// Item failures of all parts of a stage are logged one by one, any other error fails the stage
+	count, last := 0, ""
+	switch {
+	case stageErr == nil:
+	case pipeline.Partial(stageErr):
+		items := pipeline.Items(stageErr)
+		for _, item := range items {
+			count, last = count+1, item.Error()
+			slog.ErrorContext(ctx, "Stage item failed", item.Kind, item.Item, "error", item.Err)
+		}
+	default:
+		count, last = 1, stageErr.Error()
+		slog.ErrorContext(ctx, "Stage failed", "error", stageErr)
+	}
+
+	if id != 0 {
+		_, err = db.Exec(model.Set_Stage_Run_finished, time.Now().UTC(), count, last, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Stage run recording error", "error", err)
+		}
+	}
+
+	if stageErr != nil {
+		return &pipeline.StageError{Stage: name, Err: stageErr}
+	}
+	return nil
+}
+
+// usageError is returned by commands given bad arguments: it is printed without being logged as a failure,
+// and the process exits with exitUsage
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// exitCode returns the process exit code for the error of a command
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, errDossierNotFound):
+		return exitNotFound
+	case pipeline.Partial(err):
+		return exitPartial
+	}
+	return exitFailed
+}
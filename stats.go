@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+
+	"romaniabot/pkg/stats"
+)
+
+// Stats prints how many months dossiers took from registration to their order, for orders dated within rolling
+// windows ending today: for all orders, per source and per source and order series.
+// Usage: stats [-windows 90,180,365] [-source url] [-series series]
+func Stats(ctx context.Context, db *sql.DB, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	windowsRaw := flags.String("windows", "90,180,365", "rolling windows in days")
+	source := flags.String("source", "", "only orders found on this listing page")
+	series := flags.String("series", "", "only orders of this series, e.g. P")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	windows, err := stats.ParseWindows(*windowsRaw)
+	if err != nil {
+		return err
+	}
+
+	distributions, err := stats.ProcessingTimes(ctx, db, stats.Options{Windows: windows, Source: *source, Series: *series})
+	if err != nil {
+		return err
+	}
+
+	// Dossier registration is only known by year, see stats.Distribution
+	fmt.Println("Months from dossier registration (1 July of the dossier year) to order")
+	fmt.Println("window\tfrom\tto\tsource\tseries\tdossiers\tmin\tp25\tmedian\tp75\tp90\tmax\tmean")
+	for _, d := range distributions {
+		source, series := d.Source, d.Series
+		if source == "" {
+			source = "all"
+		}
+		if series == "" {
+			series = "all"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\t%.1f\n", d.Window,
+			d.From.Format("2006-01-02"), d.To.Format("2006-01-02"), source, series, d.Dossiers,
+			d.Min, d.P25, d.Median, d.P75, d.P90, d.Max, d.Mean)
+	}
+	return nil
+}
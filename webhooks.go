@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"romaniabot/model"
+	"romaniabot/pkg/webhooks"
+)
+
+// emit queues a webhook event; failures are logged and don't stop the pipeline
+func emit(ctx context.Context, db *sql.DB, event string, data any) {
+	err := webhooks.Emit(ctx, db, event, data)
+	if err != nil {
+		slog.ErrorContext(ctx, "Webhook event queueing error", "event", event, "error", err)
+	}
+}
+
+// flushWebhooks sends due webhook deliveries; failed attempts are retried by later flushes and are not errors
+func flushWebhooks(ctx context.Context, db *sql.DB) error {
+	delivered, failed, err := webhooks.Flush(ctx, db)
+	if delivered+failed > 0 {
+		slog.InfoContext(ctx, "Webhook deliveries sent", "delivered", delivered, "failed", failed)
+	}
+	if err != nil {
+		return fmt.Errorf("error delivering webhooks: %w", err)
+	}
+	return nil
+}
+
+// Webhooks manages outgoing webhooks
+// Usage:
+//
+//	webhooks add <url> <secret> [event,event|*]
+//	webhooks list
+//	webhooks remove <id>
+//	webhooks deliveries [limit]
+//	webhooks deliver
+//	webhooks replay <delivery id>
+func Webhooks(ctx context.Context, db *sql.DB, args []string) error {
+	usage := usageError("usage: webhooks add <url> <secret> [events] | list | remove <id> | deliveries [limit] | deliver | replay <delivery id>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 3 || len(args) > 4 {
+			return usage
+		}
+		if err := webhooks.CheckURL(args[1]); err != nil {
+			return usageError(err.Error())
+		}
+		events := "*"
+		if len(args) == 4 {
+			events = args[3]
+			for _, e := range strings.Split(events, ",") {
+				if !validEvent(strings.TrimSpace(e)) {
+					return usageError(fmt.Sprintf("unknown event %q, expected one of %s", e, strings.Join(webhooks.Events, ", ")))
+				}
+			}
+		}
+		res, err := db.ExecContext(ctx, model.Insert_Webhook, args[1], args[2], events)
+		if err != nil {
+			return fmt.Errorf("error adding webhook: %w", err)
+		}
+		id, _ := res.LastInsertId()
+		fmt.Println("Webhook added:", id)
+
+	case "list":
+		rows, err := db.QueryContext(ctx, model.Get_Webhooks)
+		if err != nil {
+			return fmt.Errorf("error reading webhooks: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var h model.Webhook
+			if err := rows.Scan(&h.ID, &h.URL, &h.Secret, &h.Events, &h.IsActive, &h.CreatedAt); err != nil {
+				return fmt.Errorf("error scanning webhook: %w", err)
+			}
+			fmt.Printf("%d\t%s\t%s\tactive=%t\n", h.ID, h.URL, h.Events, h.IsActive)
+		}
+		return rows.Err()
+
+	case "remove":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid webhook ID %q", args[1]))
+		}
+		if _, err := db.ExecContext(ctx, model.Delete_Webhook, id); err != nil {
+			return fmt.Errorf("error removing webhook: %w", err)
+		}
+
+	case "deliveries":
+		limit := 50
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return usageError(fmt.Sprintf("invalid limit %q", args[1]))
+			}
+			limit = n
+		}
+		deliveries, err := webhooks.Deliveries(ctx, db, limit)
+		if err != nil {
+			return err
+		}
+		for _, d := range deliveries {
+			fmt.Printf("%d\t%s\t%s\t%s\tattempts=%d\tstatus=%d\tnext=%s\t%s\n", d.ID, d.CreatedAt.Format(time.RFC3339),
+				d.Event, d.Status, d.Attempts, d.ResponseStatus, d.NextAttemptAt.Format(time.RFC3339), d.LastError)
+		}
+
+	case "deliver":
+		return flushWebhooks(ctx, db)
+
+	case "replay":
+		if len(args) != 2 {
+			return usage
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return usageError(fmt.Sprintf("invalid delivery ID %q", args[1]))
+		}
+		if err := webhooks.Replay(ctx, db, id); err != nil {
+			return err
+		}
+		return flushWebhooks(ctx, db)
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// validEvent reports whether e is a known event type or "*"
+func validEvent(e string) bool {
+	if e == "*" {
+		return true
+	}
+	for _, known := range webhooks.Events {
+		if e == known {
+			return true
+		}
+	}
+	return false
+}